@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zippoxer/george/forge"
+)
+
+var phpVersionRegexp = regexp.MustCompile(`^php(\d)(\d+)$`)
+
+// phpBinary returns the name of the PHP binary of a Forge PHP version,
+// such as php7.3 for "php73". It's plain php if the version is unknown.
+func phpBinary(version string) string {
+	m := phpVersionRegexp.FindStringSubmatch(version)
+	if m == nil {
+		return "php"
+	}
+	return fmt.Sprintf("php%s.%s", m[1], m[2])
+}
+
+// sitePHPBinary returns the PHP binary the site runs on, falling back to
+// the server's default PHP version.
+func sitePHPBinary(server *forge.Server, site *forge.Site) string {
+	if site.PhpVersion != "" {
+		return phpBinary(site.PhpVersion)
+	}
+	return phpBinary(server.PhpVersion)
+}
+
+// artisanCommand returns a shell command running artisan with the given
+// arguments in the site's directory.
+func artisanCommand(server *forge.Server, site *forge.Site, args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return fmt.Sprintf("cd %s && exec %s artisan %s",
+		shellQuote(site.Name), sitePHPBinary(server, site), strings.Join(quoted, " "))
+}
+
+// Artisan runs artisan with the given arguments in the site's directory,
+// on a terminal if the local one is, and returns artisan's exit code.
+func (g *George) Artisan(ctx context.Context, server *forge.Server, site *forge.Site, args []string) (int, error) {
+	return g.SSHShell(ctx, server.Id, artisanCommand(server, site, args))
+}
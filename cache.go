@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -25,14 +26,14 @@ func newCache(client *forge.Client) *cache {
 	}
 }
 
-func (c *cache) Servers() ([]forge.Server, error) {
+func (c *cache) Servers(ctx context.Context) ([]forge.Server, error) {
 	c.serversMu.Lock()
 	ok := c.servers != nil
 	c.serversMu.Unlock()
 	if ok {
 		return c.servers, nil
 	}
-	servers, err := c.client.Servers().List()
+	servers, err := c.client.Servers().ListContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -42,8 +43,8 @@ func (c *cache) Servers() ([]forge.Server, error) {
 	return servers, nil
 }
 
-func (c *cache) Server(id int) (*forge.Server, error) {
-	servers, err := c.Servers()
+func (c *cache) Server(ctx context.Context, id int) (*forge.Server, error) {
+	servers, err := c.Servers(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -57,14 +58,14 @@ func (c *cache) Server(id int) (*forge.Server, error) {
 	return nil, fmt.Errorf("Server not found.")
 }
 
-func (c *cache) Sites(serverId int) ([]forge.Site, error) {
+func (c *cache) Sites(ctx context.Context, serverId int) ([]forge.Site, error) {
 	c.sitesMu.Lock()
 	sites, ok := c.sites[serverId]
 	c.sitesMu.Unlock()
 	if ok {
 		return sites, nil
 	}
-	sites, err := c.client.Sites(serverId).List()
+	sites, err := c.client.Sites(serverId).ListContext(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -79,10 +80,10 @@ type ServerSites struct {
 	Sites []forge.Site
 }
 
-func (c *cache) ServerSites(servers []forge.Server) ([]ServerSites, error) {
+func (c *cache) ServerSites(ctx context.Context, servers []forge.Server) ([]ServerSites, error) {
 	if servers == nil {
 		var err error
-		servers, err = c.Servers()
+		servers, err = c.Servers(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -91,9 +92,10 @@ func (c *cache) ServerSites(servers []forge.Server) ([]ServerSites, error) {
 	errChan := make(chan error, len(servers))
 	for _, server := range servers {
 		go func(server forge.Server) {
-			sites, err := c.Sites(server.Id)
+			sites, err := c.Sites(ctx, server.Id)
 			if err != nil {
 				errChan <- err
+				return
 			}
 			dataChan <- ServerSites{Server: server, Sites: sites}
 		}(server)
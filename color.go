@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ANSI color codes. They're all two digits long, so colored text has the
+// same width overhead regardless of the color, which keeps tables aligned.
+const (
+	colorRed     = 31
+	colorGreen   = 32
+	colorYellow  = 33
+	colorBlue    = 34
+	colorMagenta = 35
+	colorCyan    = 36
+	colorDefault = 39
+)
+
+// prefixColors are cycled through to tell apart the output of several
+// servers or sites.
+var prefixColors = []int{colorCyan, colorMagenta, colorBlue, colorYellow, colorGreen}
+
+// useColor reports whether output to stdout should be colored.
+var useColor = terminal.IsTerminal(int(os.Stdout.Fd())) &&
+	os.Getenv("NO_COLOR") == "" &&
+	os.Getenv("TERM") != "dumb"
+
+// colorize wraps s with the given color, if output is colored.
+func colorize(color int, s string) string {
+	if !useColor {
+		return s
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, s)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gobwas/glob"
+	"gopkg.in/yaml.v2"
+
+	"github.com/zippoxer/george/forge"
+)
+
+// Config is george's config file.
+type Config struct {
+	// Aliases maps short names to search patterns, such as "api" to
+	// "production:api-v2.production.example.com".
+	Aliases map[string]string `yaml:"aliases,omitempty"`
+
+	// Protected are globs of site names, such as "*.example.com", whose
+	// databases george refuses to write to.
+	Protected []string `yaml:"protected,omitempty"`
+
+	// Identity is the private SSH key to use when --identity isn't given.
+	// It's set by george keys rotate.
+	Identity string `yaml:"identity,omitempty"`
+}
+
+// ConfigPath returns the path of george's config file, which is in
+// $XDG_CONFIG_HOME or ~/.config on every Unix, macOS included, and in
+// %AppData% on Windows.
+func ConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if runtime.GOOS == "windows" {
+		var err error
+		if dir, err = os.UserConfigDir(); err != nil {
+			return "", err
+		}
+	} else if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "george", "config.yaml"), nil
+}
+
+// loadConfig reads the config file, returning an empty config if it
+// doesn't exist.
+func loadConfig() (*Config, error) {
+	config := &Config{}
+	path, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(b, config); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return config, nil
+}
+
+// save writes the config file.
+func (c *Config) save() error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// resolveAlias returns the pattern aliased by pattern, or pattern itself
+// if it isn't an alias.
+func (g *George) resolveAlias(pattern string) string {
+	if target, ok := g.config.Aliases[strings.ToLower(pattern)]; ok {
+		return target
+	}
+	return pattern
+}
+
+// AddAlias saves name as an alias of pattern, replacing any alias with the
+// same name.
+func (g *George) AddAlias(name, pattern string) error {
+	name = strings.ToLower(name)
+	if name == "" || strings.ContainsAny(name, ":"+globChars) {
+		return fmt.Errorf("Invalid alias %q: aliases can't contain ':' or glob characters.", name)
+	}
+	if g.config.Aliases == nil {
+		g.config.Aliases = make(map[string]string)
+	}
+	g.config.Aliases[name] = pattern
+	return g.config.save()
+}
+
+// RemoveAlias removes the alias with the given name.
+func (g *George) RemoveAlias(name string) error {
+	name = strings.ToLower(name)
+	if _, ok := g.config.Aliases[name]; !ok {
+		return fmt.Errorf("No alias named %q.", name)
+	}
+	delete(g.config.Aliases, name)
+	return g.config.save()
+}
+
+// PrintAliases prints the aliases sorted by name.
+func (g *George) PrintAliases(w io.Writer) error {
+	var names []string
+	for name := range g.config.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ALIAS\tPATTERN")
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s\t%s\n", name, g.config.Aliases[name])
+	}
+	return tw.Flush()
+}
+
+// checkWritable returns an error if the database of site is protected by
+// a pattern in the config file. There's deliberately no way around it
+// other than editing the config file.
+func (g *George) checkWritable(site *forge.Site) error {
+	for _, pattern := range g.config.Protected {
+		gl, err := glob.Compile(strings.ToLower(pattern))
+		if err != nil {
+			return fmt.Errorf("Invalid protected pattern %q: %v", pattern, err)
+		}
+		if gl.Match(strings.ToLower(site.Name)) {
+			path, _ := ConfigPath()
+			return fmt.Errorf("%s is protected by the pattern %q in %s, so george won't write to its database.",
+				site.Name, pattern, path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zippoxer/george/forge"
+)
+
+// database is a site's database, as configured in its .env file.
+type database struct {
+	// Driver is mysql, mariadb or pgsql.
+	Driver   string
+	Host     string
+	Port     string
+	Name     string
+	User     string
+	Password string
+}
+
+// parseDatabase finds the database settings of a Laravel or WordPress site
+// in its .env file.
+func parseDatabase(env forge.DotEnv) (*database, error) {
+	db := &database{
+		Driver:   env.Get("DB_CONNECTION"),
+		Host:     env.Get("DB_HOST"),
+		Port:     env.Get("DB_PORT"),
+		Name:     env.Get("DB_DATABASE", "DB_NAME"),
+		User:     env.Get("DB_USERNAME", "DB_USER"),
+		Password: env.Get("DB_PASSWORD"),
+	}
+	if db.Driver == "" && env.Get("DB_NAME") != "" {
+		// WordPress only supports MySQL.
+		db.Driver = "mysql"
+	}
+	switch db.Driver {
+	case "":
+		return nil, fmt.Errorf("No database found for this site.")
+	case "mysql", "mariadb":
+		if db.Port == "" {
+			db.Port = "3306"
+		}
+	case "pgsql":
+		if db.Port == "" {
+			db.Port = "5432"
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported database %s.", db.Driver)
+	}
+	if db.Host == "" {
+		db.Host = "127.0.0.1"
+	}
+	if db.Name == "" {
+		return nil, fmt.Errorf("The site's .env has no database name.")
+	}
+	return db, nil
+}
+
+// SiteDatabase returns the database of the given site.
+func (g *George) SiteDatabase(ctx context.Context, server *forge.Server, site *forge.Site) (*database, error) {
+	env, err := g.client.Env(server.Id, site.Id).GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return parseDatabase(env)
+}
+
+func (db *database) postgres() bool {
+	return db.Driver == "pgsql"
+}
+
+// passwordLine returns the first line of stdin of the commands built by
+// db, which carries the password so that it doesn't show in the process
+// list. For MySQL, it's escaped for an option file.
+func (db *database) passwordLine() (string, error) {
+	if strings.ContainsAny(db.Password, "\r\n") {
+		return "", fmt.Errorf("Database passwords with line breaks aren't supported.")
+	}
+	if db.postgres() {
+		return db.Password + "\n", nil
+	}
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(db.Password) + "\n", nil
+}
+
+// readPassword returns a bash command reading a password, sent as a line
+// of stdin, into the variable pwVar.
+func readPassword(pwVar string) string {
+	return "IFS= read -r " + pwVar
+}
+
+// command returns a bash command running the given client program of the
+// database, such as mysqldump or pg_dump, with the connection options
+// first. The password is taken from the variable pwVar.
+func (db *database) command(pwVar, program string, args ...string) string {
+	var script string
+	if db.postgres() {
+		script = fmt.Sprintf(`PGPASSWORD="$%s" %s --host=%s --port=%s --username=%s`,
+			pwVar, program, shellQuote(db.Host), shellQuote(db.Port), shellQuote(db.User))
+	} else {
+		script = fmt.Sprintf(`%s --defaults-extra-file=<(printf '[client]\npassword="%%s"\n' "$%s") --host=%s --port=%s --user=%s`,
+			program, pwVar, shellQuote(db.Host), shellQuote(db.Port), shellQuote(db.User))
+	}
+	for _, arg := range args {
+		script += " " + shellQuote(arg)
+	}
+	return script
+}
+
+// dumpOptions choose what george dbdump dumps.
+type dumpOptions struct {
+	// Tables only dumps the given tables, unless empty.
+	Tables []string
+
+	// ExcludeTables leaves out the given tables.
+	ExcludeTables []string
+
+	// NoData only dumps the schema.
+	NoData bool
+
+	// Where only dumps the rows matching a condition. MySQL only.
+	Where string
+
+	// Clean drops tables before creating them, and leaves out ownership,
+	// so the dump can replace the contents of another database. MySQL
+	// dumps do so anyway.
+	Clean bool
+}
+
+// dumpProgram returns the program dumping db.
+func (db *database) dumpProgram() string {
+	if db.postgres() {
+		return "pg_dump"
+	}
+	return "mysqldump"
+}
+
+// dumpCommand returns a bash command writing a gzip-compressed dump of db
+// to stdout.
+func (db *database) dumpCommand(opts dumpOptions) (string, error) {
+	dump, err := db.dumpScript("pw", opts)
+	if err != nil {
+		return "", err
+	}
+	script := "set -o pipefail; " + readPassword("pw") + " && " + dump + " | gzip"
+	return "bash -c " + shellQuote(script), nil
+}
+
+// dumpScript returns a bash command writing a dump of db to stdout, with
+// the password taken from the variable pwVar.
+func (db *database) dumpScript(pwVar string, opts dumpOptions) (string, error) {
+	var args []string
+	if db.postgres() {
+		if opts.Where != "" {
+			return "", fmt.Errorf("--where isn't supported for PostgreSQL.")
+		}
+		args = append(args, "--no-password")
+		if opts.Clean {
+			args = append(args, "--clean", "--if-exists", "--no-owner", "--no-acl")
+		}
+		if opts.NoData {
+			args = append(args, "--schema-only")
+		}
+		for _, t := range opts.Tables {
+			args = append(args, "--table="+t)
+		}
+		for _, t := range opts.ExcludeTables {
+			args = append(args, "--exclude-table="+t)
+		}
+		args = append(args, db.Name)
+	} else {
+		if opts.NoData {
+			args = append(args, "--no-data")
+		}
+		if opts.Where != "" {
+			args = append(args, "--where="+opts.Where)
+		}
+		for _, t := range opts.ExcludeTables {
+			args = append(args, "--ignore-table="+db.Name+"."+t)
+		}
+		args = append(args, db.Name)
+		args = append(args, opts.Tables...)
+	}
+	return db.command(pwVar, db.dumpProgram(), args...), nil
+}
+
+// DumpDatabase writes a dump of db, on the given server, to w. The dump is
+// compressed with gzip in transit.
+func (g *George) DumpDatabase(ctx context.Context, server *forge.Server, db *database, opts dumpOptions, w, stderr io.Writer) error {
+	cmd, err := db.dumpCommand(opts)
+	if err != nil {
+		return err
+	}
+	password, err := db.passwordLine()
+	if err != nil {
+		return err
+	}
+	session, err := g.SSH(ctx, server.Id)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.Stdin = strings.NewReader(password)
+	session.Stderr = stderr
+	pr, pw := io.Pipe()
+	session.Stdout = pw
+	decompressed := make(chan error, 1)
+	go func() {
+		gzr, err := gzip.NewReader(pr)
+		if err == nil {
+			_, err = io.Copy(w, gzr)
+		}
+		if err != nil {
+			// Stop the dump rather than leave it blocked writing.
+			session.Close()
+		}
+		pr.CloseWithError(err)
+		decompressed <- err
+	}()
+
+	err = runSession(ctx, cmd, session)
+	pw.Close()
+	var exitErr *ssh.ExitError
+	if derr := <-decompressed; derr != nil && !errors.As(err, &exitErr) {
+		// The dump ran, but failed to decompress or be written.
+		err = derr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", db.dumpProgram(), err)
+	}
+	return nil
+}
+
+// restoreCommand returns a bash command restoring db from a gzip-compressed
+// dump read from stdin, after the password.
+func (db *database) restoreCommand() string {
+	script := "set -o pipefail; " + readPassword("pw") + " && gunzip | " + db.restoreScript("pw")
+	return "bash -c " + shellQuote(script)
+}
+
+// restoreScript returns a bash command restoring db from a dump read from
+// stdin, with the password taken from the variable pwVar.
+func (db *database) restoreScript(pwVar string) string {
+	if db.postgres() {
+		return db.command(pwVar, "psql", "--no-password", "--quiet", "--set=ON_ERROR_STOP=1", "--dbname="+db.Name)
+	}
+	return db.command(pwVar, "mysql", db.Name)
+}
+
+// restoreProgram returns the program restoring db.
+func (db *database) restoreProgram() string {
+	if db.postgres() {
+		return "psql"
+	}
+	return "mysql"
+}
+
+// RestoreDatabase restores db, on the given server, from a plain or
+// gzip-compressed dump read from r. The dump is compressed with gzip in
+// transit.
+func (g *George) RestoreDatabase(ctx context.Context, server *forge.Server, db *database, r io.Reader, stderr io.Writer) error {
+	password, err := db.passwordLine()
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	var dump io.Reader = br
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		pr, pw := io.Pipe()
+		go func() {
+			gw := gzip.NewWriter(pw)
+			_, err := io.Copy(gw, br)
+			if cerr := gw.Close(); err == nil {
+				err = cerr
+			}
+			pw.CloseWithError(err)
+		}()
+		defer pr.Close()
+		dump = pr
+	}
+
+	session, err := g.SSH(ctx, server.Id)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.Stdin = io.MultiReader(strings.NewReader(password), dump)
+	session.Stdout = stderr
+	session.Stderr = stderr
+	err = runSession(ctx, db.restoreCommand(), session)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", db.restoreProgram(), err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zippoxer/george/forge"
+)
+
+// siteDatabase is a site's database, along with where it's at.
+type siteDatabase struct {
+	Server *forge.Server
+	Site   *forge.Site
+	DB     *database
+}
+
+// compatible reports whether a dump of db can be restored into other.
+func (db *database) compatible(other *database) bool {
+	return db.postgres() == other.postgres()
+}
+
+// CopyDatabase replaces the contents of the database of to with those of
+// from, leaving out the excluded tables. If both sites are on the same
+// server, the copy runs there, and otherwise it goes through this machine,
+// compressed with gzip.
+func (g *George) CopyDatabase(ctx context.Context, from, to *siteDatabase, excludeTables []string, stderr io.Writer) error {
+	if err := g.checkWritable(to.Site); err != nil {
+		return err
+	}
+	if !from.DB.compatible(to.DB) {
+		return fmt.Errorf("Can't copy a %s database into a %s database.", from.DB.Driver, to.DB.Driver)
+	}
+	if from.Server.Id == to.Server.Id && from.DB.Host == to.DB.Host &&
+		from.DB.Port == to.DB.Port && from.DB.Name == to.DB.Name {
+		return fmt.Errorf("%s and %s share the database %s.", from.Site.Name, to.Site.Name, to.DB.Name)
+	}
+	opts := dumpOptions{ExcludeTables: excludeTables, Clean: true}
+	if from.Server.Id == to.Server.Id {
+		return g.copyDatabaseOnServer(ctx, from, to, opts, stderr)
+	}
+	return g.copyDatabaseBetweenServers(ctx, from, to, opts, stderr)
+}
+
+// copyDatabaseOnServer pipes the dump straight into the destination on the
+// server both databases are on.
+func (g *George) copyDatabaseOnServer(ctx context.Context, from, to *siteDatabase, opts dumpOptions, stderr io.Writer) error {
+	fromPassword, err := from.DB.passwordLine()
+	if err != nil {
+		return err
+	}
+	toPassword, err := to.DB.passwordLine()
+	if err != nil {
+		return err
+	}
+	dump, err := from.DB.dumpScript("pw", opts)
+	if err != nil {
+		return err
+	}
+	script := "set -o pipefail; " + readPassword("pw") + " && " + readPassword("pw2") + " && " +
+		dump + " | " + to.DB.restoreScript("pw2")
+
+	session, err := g.SSH(ctx, from.Server.Id)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.Stdin = strings.NewReader(fromPassword + toPassword)
+	session.Stdout = stderr
+	session.Stderr = stderr
+	if err := runSession(ctx, "bash -c "+shellQuote(script), session); err != nil {
+		return fmt.Errorf("Copying failed: %v", err)
+	}
+	return nil
+}
+
+// copyDatabaseBetweenServers pipes the gzip-compressed dump from the source
+// server through this machine into the destination server.
+func (g *George) copyDatabaseBetweenServers(ctx context.Context, from, to *siteDatabase, opts dumpOptions, stderr io.Writer) error {
+	dumpCmd, err := from.DB.dumpCommand(opts)
+	if err != nil {
+		return err
+	}
+	fromPassword, err := from.DB.passwordLine()
+	if err != nil {
+		return err
+	}
+	toPassword, err := to.DB.passwordLine()
+	if err != nil {
+		return err
+	}
+
+	dumpSession, err := g.SSH(ctx, from.Server.Id)
+	if err != nil {
+		return err
+	}
+	defer dumpSession.Close()
+	dumpSession.Stdin = strings.NewReader(fromPassword)
+	dumpSession.Stderr = stderr
+	dump, err := dumpSession.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	restoreSession, err := g.SSH(ctx, to.Server.Id)
+	if err != nil {
+		return err
+	}
+	defer restoreSession.Close()
+	progress := newProgressReader(dump, 0)
+	restoreSession.Stdin = io.MultiReader(strings.NewReader(toPassword), progress)
+	restoreSession.Stdout = stderr
+	restoreSession.Stderr = stderr
+
+	if err := dumpSession.Start(dumpCmd); err != nil {
+		return err
+	}
+	stop := progress.Start()
+	err = runSession(ctx, to.DB.restoreCommand(), restoreSession)
+	stop()
+	if err != nil {
+		// Nothing reads the rest of the dump anymore.
+		dumpSession.Close()
+	}
+	// The restore fails too when the dump fails, but the dump's error
+	// tells why.
+	dumpErr := dumpSession.Wait()
+	var exitErr *ssh.ExitError
+	if ctx.Err() == nil && dumpErr != nil && (err == nil || errors.As(dumpErr, &exitErr)) {
+		return fmt.Errorf("%s: %v", from.DB.dumpProgram(), dumpErr)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", to.DB.restoreProgram(), err)
+	}
+	return nil
+}
+
+// runSession runs cmd on session and waits for it to exit, closing the
+// session early if ctx is done.
+func runSession(ctx context.Context, cmd string, session *ssh.Session) error {
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+	defer closeOnDone(ctx, session)()
+	err := session.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
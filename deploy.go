@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zippoxer/george/forge"
+)
+
+// deployPollInterval is how often a running deployment is checked for
+// new output.
+const deployPollInterval = 2 * time.Second
+
+// deployStartTimeout is how long Forge may take to start a deployment,
+// including time spent queued, before george gives up on it.
+const deployStartTimeout = 3 * time.Minute
+
+// Deploy triggers a deployment of the given site and streams its output
+// to w until it's done, returning an error if the deployment failed.
+func (g *George) Deploy(ctx context.Context, server *forge.Server, site *forge.Site, w io.Writer) error {
+	deployments := g.client.Deployments(server.Id, site.Id)
+
+	// Remember the latest deployment, so we can tell which is ours.
+	history, err := deployments.ListContext(ctx)
+	if err != nil {
+		return err
+	}
+	lastId := 0
+	for _, d := range history {
+		if d.Id > lastId {
+			lastId = d.Id
+		}
+	}
+
+	started, err := deployments.DeployContext(ctx)
+	if err != nil {
+		return err
+	}
+	if started.DeploymentStatus != "" {
+		fmt.Fprintf(os.Stderr, "Deploying %s (%s)...\n", site.Name, started.DeploymentStatus)
+	} else {
+		fmt.Fprintf(os.Stderr, "Deploying %s...\n", site.Name)
+	}
+
+	// Forge doesn't tell the id of the deployment it started, so ours is
+	// the first to show up in the history after the ones we've seen.
+	var deployment *forge.Deployment
+	deadline := time.Now().Add(deployStartTimeout)
+	for deployment == nil {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Forge didn't record a deployment of %s within %v. Check its deployment history on Forge.",
+				site.Name, deployStartTimeout)
+		}
+		if err := sleep(ctx, deployPollInterval); err != nil {
+			return err
+		}
+		history, err := deployments.ListContext(ctx)
+		if err != nil {
+			return err
+		}
+		for i := range history {
+			if history[i].Id > lastId && (deployment == nil || history[i].Id < deployment.Id) {
+				deployment = &history[i]
+			}
+		}
+	}
+
+	var printed int
+	for {
+		deployment, err = deployments.GetContext(ctx, deployment.Id)
+		if err != nil {
+			return err
+		}
+		output, err := deployments.OutputContext(ctx, deployment.Id)
+		if err != nil && !errors.Is(err, forge.ErrNotFound) {
+			return err
+		}
+		if len(output) > printed {
+			if _, err := io.WriteString(w, output[printed:]); err != nil {
+				return err
+			}
+			printed = len(output)
+		}
+		if deployment.Done() {
+			break
+		}
+		if err := sleep(ctx, deployPollInterval); err != nil {
+			return err
+		}
+	}
+	if deployment.Failed() {
+		return fmt.Errorf("Deployment of %s %s.", site.Name, deployment.Status)
+	}
+	fmt.Fprintf(os.Stderr, "Deployed %s.\n", site.Name)
+	return nil
+}
+
+// EditDeployScript opens the deploy script of the given site in the user's
+// editor, and uploads it after confirming the changes.
+func (g *George) EditDeployScript(ctx context.Context, server *forge.Server, site *forge.Site) error {
+	deployments := g.client.Deployments(server.Id, site.Id)
+	script, err := deployments.ScriptContext(ctx)
+	if err != nil {
+		return err
+	}
+	edited, err := editText(script, "deploy-*.sh")
+	if err != nil {
+		return err
+	}
+	diff := unifiedDiff(site.Name+"/deploy.sh", site.Name+"/deploy.sh", script, edited)
+	if diff == "" {
+		fmt.Fprintln(os.Stderr, "No changes.")
+		return nil
+	}
+	fmt.Print(diff)
+	if !confirm(fmt.Sprintf("Upload the deploy script of %s?", site.Name)) {
+		return errors.New("Aborted.")
+	}
+	return deployments.UpdateScriptContext(ctx, edited)
+}
+
+// SetDeployScript replaces the deploy script of the given site with
+// script, printing the changes. It does nothing if the script is unchanged.
+func (g *George) SetDeployScript(ctx context.Context, server *forge.Server, site *forge.Site, script string) error {
+	deployments := g.client.Deployments(server.Id, site.Id)
+	current, err := deployments.ScriptContext(ctx)
+	if err != nil {
+		return err
+	}
+	diff := unifiedDiff(site.Name+"/deploy.sh", site.Name+"/deploy.sh", current, script)
+	if diff == "" {
+		fmt.Fprintf(os.Stderr, "Deploy script of %s is up to date.\n", site.Name)
+		return nil
+	}
+	fmt.Print(diff)
+	if err := deployments.UpdateScriptContext(ctx, script); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Updated deploy script of %s.\n", site.Name)
+	return nil
+}
+
+// siteDeployment is the latest deployment of a site.
+type siteDeployment struct {
+	Server     forge.Server
+	Site       forge.Site
+	Deployment *forge.Deployment
+	Err        error
+}
+
+// LatestDeployments fetches the latest deployment of each of the given sites,
+// sorted by server and site name. The sites of each server are listed again
+// first, so that their deployment status is current rather than cached.
+func (g *George) LatestDeployments(ctx context.Context, serverSites []ServerSites) []siteDeployment {
+	var (
+		results []siteDeployment
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+	)
+	for _, server := range serverSites {
+		wg.Add(1)
+		go func(server ServerSites) {
+			defer wg.Done()
+			sites, err := g.client.Sites(server.Id).ListContext(ctx)
+			current := make(map[int]forge.Site)
+			for _, site := range sites {
+				current[site.Id] = site
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			for _, site := range server.Sites {
+				r := siteDeployment{Server: server.Server, Site: site, Err: err}
+				if updated, ok := current[site.Id]; ok {
+					r.Site = updated
+				}
+				results = append(results, r)
+			}
+		}(server)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Server.Name != results[j].Server.Name {
+			return results[i].Server.Name < results[j].Server.Name
+		}
+		return results[i].Site.Name < results[j].Site.Name
+	})
+	for i := range results {
+		if results[i].Err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(r *siteDeployment) {
+			defer wg.Done()
+			r.Deployment, r.Err = g.client.Deployments(r.Server.Id, r.Site.Id).LatestContext(ctx)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// PrintDeployments prints the latest deployment of every site matching
+// pattern. If interval is positive, it keeps refreshing the table in place
+// until ctx is done.
+func (g *George) PrintDeployments(ctx context.Context, w io.Writer, pattern string, interval time.Duration) error {
+	serverSites, err := g.MatchServerSites(ctx, pattern)
+	if err != nil {
+		return err
+	}
+	for {
+		deployments := g.LatestDeployments(ctx, serverSites)
+		if ctx.Err() != nil {
+			// Interrupted while watching.
+			return nil
+		}
+		var b bytes.Buffer
+		if interval > 0 {
+			// Clear the screen and move to its top.
+			b.WriteString("\x1b[H\x1b[2J")
+			fmt.Fprintf(&b, "Every %v, last updated %s\n\n", interval, time.Now().Format("15:04:05"))
+		}
+		writeDeployments(&b, deployments)
+		if _, err := w.Write(b.Bytes()); err != nil {
+			return err
+		}
+		if interval <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, interval); err != nil {
+			return nil
+		}
+	}
+}
+
+func writeDeployments(w io.Writer, deployments []siteDeployment) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tSITE\tSTATUS\tCOMMIT\tAUTHOR\tSTARTED\tMESSAGE")
+	for _, d := range deployments {
+		status, commit, author, started, message := "-", "", "", "", ""
+		color := colorDefault
+		switch {
+		case d.Err != nil:
+			status, message, color = "error", d.Err.Error(), colorRed
+		case d.Deployment != nil:
+			status = d.Deployment.Status
+			commit = d.Deployment.CommitHash
+			if len(commit) > 7 {
+				commit = commit[:7]
+			}
+			author = d.Deployment.CommitAuthor
+			started = d.Deployment.StartedAt
+			message = firstLine(d.Deployment.CommitMessage, 60)
+			switch {
+			case d.Deployment.Failed():
+				color = colorRed
+			case !d.Deployment.Done():
+				color = colorYellow
+			default:
+				color = colorGreen
+			}
+		case d.Site.DeploymentStatus == "failed":
+			status, color = d.Site.DeploymentStatus, colorRed
+		case d.Site.DeploymentStatus != "":
+			// Deploying, but not in the history yet.
+			status, color = d.Site.DeploymentStatus, colorYellow
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			d.Server.Name, d.Site.Name, colorize(color, status), commit, author, started, message)
+	}
+	tw.Flush()
+}
+
+// firstLine returns the first line of s, truncated to max characters.
+func firstLine(s string, max int) string {
+	if i := strings.IndexAny(s, "\r\n"); i >= 0 {
+		s = s[:i]
+	}
+	if r := []rune(s); len(r) > max {
+		s = string(r[:max-1]) + "…"
+	}
+	return s
+}
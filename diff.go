@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-' or '+'.
+	line string
+}
+
+// unifiedDiff returns a unified diff between the lines of a and b, or an
+// empty string if they're exactly equal. Line endings and the trailing
+// newline are left out of the diff, and described instead if they're all
+// that changed.
+func unifiedDiff(aName, bName, a, b string) string {
+	if a == b {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+	changed := false
+	for _, op := range ops {
+		if op.kind != ' ' {
+			changed = true
+			break
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", aName, bName)
+	if !changed {
+		fmt.Fprintf(&sb, "Only %s changed.\n", lineEndingChanges(a, b))
+		return sb.String()
+	}
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk until there's enough unchanged lines to end it.
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for unchanged := 0; end < len(ops) && unchanged <= 2*diffContext; end++ {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > i && ops[end-1].kind == ' ' {
+			end--
+		}
+		end += diffContext
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		aStart, bStart := 1, 1
+		for _, op := range ops[:start] {
+			if op.kind != '+' {
+				aStart++
+			}
+			if op.kind != '-' {
+				bStart++
+			}
+		}
+		var aLen, bLen int
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		// An empty range starts at the line before it.
+		if aLen == 0 {
+			aStart--
+		}
+		if bLen == 0 {
+			bStart--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+		for _, op := range ops[start:end] {
+			sb.WriteByte(op.kind)
+			sb.WriteString(op.line)
+			sb.WriteByte('\n')
+		}
+		i = end
+	}
+	return sb.String()
+}
+
+// diffLines computes the shortest edit from a to b using the longest
+// common subsequence of lines.
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
+
+// splitLines splits s into lines, ignoring the difference between "\r\n"
+// and "\n" and a trailing newline.
+func splitLines(s string) []string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// lineEndingChanges describes how a and b differ, given that they differ
+// only by line endings or the trailing newline.
+func lineEndingChanges(a, b string) string {
+	var changes []string
+	if lineEnding(a) != lineEnding(b) {
+		changes = append(changes, fmt.Sprintf("line endings (%s to %s)", lineEnding(a), lineEnding(b)))
+	}
+	if strings.HasSuffix(a, "\n") != strings.HasSuffix(b, "\n") {
+		changes = append(changes, "the newline at the end of the file")
+	}
+	if len(changes) == 0 {
+		// Both mix line endings, differently.
+		changes = append(changes, "line endings")
+	}
+	return strings.Join(changes, " and ")
+}
+
+// lineEnding returns the line ending used by s: LF, CRLF or mixed.
+func lineEnding(s string) string {
+	crlf := strings.Count(s, "\r\n")
+	switch {
+	case crlf == 0:
+		return "LF"
+	case crlf == strings.Count(s, "\n"):
+		return "CRLF"
+	}
+	return "mixed"
+}
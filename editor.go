@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// editText opens text in the user's editor and returns the edited text.
+// The temporary file is named with the given pattern, so editors can pick
+// the right syntax highlighting.
+func editText(text, pattern string) (string, error) {
+	f, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// The editor may come with arguments, such as "code --wait".
+	args := strings.Fields(editor())
+	cmd := exec.Command(args[0], append(args[1:], f.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %v", args[0], err)
+	}
+
+	edited, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(edited), nil
+}
+
+func editor() string {
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if e := strings.TrimSpace(os.Getenv(env)); e != "" {
+			return e
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// confirm asks the user a yes or no question, defaulting to no.
+func confirm(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// confirmTyped asks the user to type answer to go on. It reads from the
+// terminal rather than stdin, which may be redirected from a file.
+func confirmTyped(question, answer string) (bool, error) {
+	ttyPath := "/dev/tty"
+	if runtime.GOOS == "windows" {
+		ttyPath = "CONIN$"
+	}
+	tty, err := os.Open(ttyPath)
+	if err != nil {
+		return false, fmt.Errorf("Can't ask for confirmation without a terminal: %v", err)
+	}
+	defer tty.Close()
+	fmt.Fprintf(os.Stderr, "%s ", question)
+	typed, _ := bufio.NewReader(tty).ReadString('\n')
+	return strings.TrimSpace(typed) == answer, nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zippoxer/george/forge"
+)
+
+var envKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// envAssignRegexp matches the start of an assignment line, capturing its key.
+var envAssignRegexp = regexp.MustCompile(`^\s*(?:export\s+)?([A-Za-z_][A-Za-z0-9_.]*)\s*=`)
+
+// envBareValueRegexp matches values that don't need quoting.
+var envBareValueRegexp = regexp.MustCompile(`^[A-Za-z0-9_./:@,+-]*$`)
+
+// envEntry is a run of lines in a .env file: either an assignment, which
+// spans several lines when its quoted value does, or a comment or blank line.
+type envEntry struct {
+	key   string
+	lines []string
+}
+
+// parseEnvEntries splits a .env file into entries, returning the line
+// separator it uses, so it can be put back together unchanged.
+func parseEnvEntries(content string) (entries []envEntry, newline string) {
+	newline = "\n"
+	if strings.Contains(content, "\r\n") {
+		newline = "\r\n"
+	}
+	lines := strings.Split(content, newline)
+	for i := 0; i < len(lines); i++ {
+		m := envAssignRegexp.FindStringSubmatch(lines[i])
+		if m == nil {
+			entries = append(entries, envEntry{lines: lines[i : i+1]})
+			continue
+		}
+		start := i
+		value := strings.TrimSpace(lines[i][len(m[0]):])
+		if len(value) > 0 && (value[0] == '"' || value[0] == '\'') &&
+			!hasClosingQuote(value[1:], value[0]) {
+			// The quoted value continues on the following lines.
+			for i+1 < len(lines) {
+				i++
+				if hasClosingQuote(lines[i], value[0]) {
+					break
+				}
+			}
+		}
+		entry := envEntry{key: m[1], lines: lines[start : i+1]}
+		entries = append(entries, entry)
+	}
+	return entries, newline
+}
+
+func hasClosingQuote(s string, quote byte) bool {
+	return closingQuote(s, quote) >= 0
+}
+
+// closingQuote returns the index of the quote closing a value quoted by
+// quote in s, or -1 if there's none.
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote == '"' {
+				i++
+			}
+		case quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// envCommentRegexp matches a comment following an unquoted value.
+var envCommentRegexp = regexp.MustCompile(`[ \t]+#.*$`)
+
+// replaceEnvValue returns the assignment e with its value replaced by value,
+// keeping everything around the value, such as export and a comment.
+func replaceEnvValue(e envEntry, value string) string {
+	assignment := strings.Join(e.lines, "\n")
+	prefix := envAssignRegexp.FindString(assignment)
+	rest := assignment[len(prefix):]
+	space := rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+	rest = rest[len(space):]
+	var suffix string
+	if len(rest) > 0 && (rest[0] == '"' || rest[0] == '\'') {
+		if i := closingQuote(rest[1:], rest[0]); i >= 0 {
+			suffix = rest[i+2:]
+		}
+	} else {
+		suffix = envCommentRegexp.FindString(rest)
+	}
+	return prefix + space + quoteEnvValue(value) + suffix
+}
+
+func formatEnvEntries(entries []envEntry, newline string) string {
+	var lines []string
+	for _, e := range entries {
+		lines = append(lines, e.lines...)
+	}
+	return strings.Join(lines, newline)
+}
+
+// setEnvVar sets key to value in the given .env file, replacing the value of
+// the existing assignment in place or appending a new one. Everything else
+// is preserved.
+func setEnvVar(content, key, value string) string {
+	entries, newline := parseEnvEntries(content)
+	line := key + "=" + quoteEnvValue(value)
+	for i, e := range entries {
+		if e.key == key {
+			entries[i].lines = []string{replaceEnvValue(e, value)}
+			return formatEnvEntries(entries, newline)
+		}
+	}
+	// Append before the empty entry that follows the trailing newline.
+	n := len(entries)
+	if n > 0 && entries[n-1].key == "" && len(entries[n-1].lines) == 1 && entries[n-1].lines[0] == "" {
+		entries = append(entries[:n-1], envEntry{key: key, lines: []string{line}}, entries[n-1])
+	} else {
+		entries = append(entries, envEntry{key: key, lines: []string{line}}, envEntry{lines: []string{""}})
+	}
+	return formatEnvEntries(entries, newline)
+}
+
+// unsetEnvVar removes every assignment of key from the given .env file,
+// reporting whether there was any.
+func unsetEnvVar(content, key string) (string, bool) {
+	entries, newline := parseEnvEntries(content)
+	var kept []envEntry
+	for _, e := range entries {
+		if e.key != key {
+			kept = append(kept, e)
+		}
+	}
+	return formatEnvEntries(kept, newline), len(kept) != len(entries)
+}
+
+// quoteEnvValue quotes value if it's needed for the value to be read back
+// as is, preferring single quotes that disable variable expansion.
+func quoteEnvValue(value string) string {
+	if envBareValueRegexp.MatchString(value) {
+		return value
+	}
+	if !strings.ContainsAny(value, "'\n\r") {
+		return "'" + value + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// SetEnv sets each KEY=VALUE assignment in the .env file of the given site.
+func (g *George) SetEnv(ctx context.Context, server *forge.Server, site *forge.Site, assignments []string) error {
+	env := g.client.Env(server.Id, site.Id)
+	content, err := env.ContentContext(ctx)
+	if err != nil {
+		return err
+	}
+	for _, a := range assignments {
+		i := strings.Index(a, "=")
+		if i < 0 {
+			return fmt.Errorf("%q is not of the form KEY=VALUE.", a)
+		}
+		key, value := a[:i], a[i+1:]
+		if !envKeyRegexp.MatchString(key) {
+			return fmt.Errorf("Invalid key %q.", key)
+		}
+		content = setEnvVar(content, key, value)
+	}
+	return env.UpdateContext(ctx, content)
+}
+
+// UnsetEnv removes the given keys from the .env file of the given site.
+func (g *George) UnsetEnv(ctx context.Context, server *forge.Server, site *forge.Site, keys []string) error {
+	env := g.client.Env(server.Id, site.Id)
+	content, err := env.ContentContext(ctx)
+	if err != nil {
+		return err
+	}
+	changed := false
+	for _, key := range keys {
+		var ok bool
+		content, ok = unsetEnvVar(content, key)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%s is not set.\n", key)
+		}
+		changed = changed || ok
+	}
+	if !changed {
+		return nil
+	}
+	return env.UpdateContext(ctx, content)
+}
+
+// EditEnv opens the .env file of the given site in the user's editor, and
+// uploads it after confirming the changes.
+func (g *George) EditEnv(ctx context.Context, server *forge.Server, site *forge.Site) error {
+	env := g.client.Env(server.Id, site.Id)
+	content, err := env.ContentContext(ctx)
+	if err != nil {
+		return err
+	}
+	edited, err := editText(content, ".env-*")
+	if err != nil {
+		return err
+	}
+	return g.pushEnv(ctx, env, site, content, edited, false)
+}
+
+// PushEnv replaces the .env file of the given site with content, after
+// confirming the changes unless yes is true.
+func (g *George) PushEnv(ctx context.Context, server *forge.Server, site *forge.Site, content string, yes bool) error {
+	env := g.client.Env(server.Id, site.Id)
+	current, err := env.ContentContext(ctx)
+	if err != nil {
+		return err
+	}
+	return g.pushEnv(ctx, env, site, current, content, yes)
+}
+
+func (g *George) pushEnv(ctx context.Context, env *forge.Env, site *forge.Site, current, content string, yes bool) error {
+	diff := unifiedDiff(site.Name+"/.env", site.Name+"/.env", current, content)
+	if diff == "" {
+		fmt.Fprintln(os.Stderr, "No changes.")
+		return nil
+	}
+	fmt.Print(diff)
+	if !yes && !confirm(fmt.Sprintf("Upload the .env file of %s?", site.Name)) {
+		return errors.New("Aborted.")
+	}
+	return env.UpdateContext(ctx, content)
+}
+
+// secretKeyRegexp matches keys whose values are masked by diffEnv.
+var secretKeyRegexp = regexp.MustCompile(`(?i)PASSWORD|KEY|SECRET|TOKEN`)
+
+// diffEnv prints the keys that were added, removed or changed from a to b,
+// masking secret values unless reveal is true. It reports whether there
+// were any differences.
+func diffEnv(w io.Writer, aName, bName string, a, b forge.DotEnv, reveal bool) bool {
+	keys := make(map[string]bool)
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	value := func(key, v string) string {
+		if !reveal && v != "" && secretKeyRegexp.MatchString(key) {
+			return "********"
+		}
+		return v
+	}
+	var lines []string
+	for _, k := range sorted {
+		av, inA := a[k]
+		bv, inB := b[k]
+		switch {
+		case !inB:
+			lines = append(lines, fmt.Sprintf("- %s=%s", k, value(k, av)))
+		case !inA:
+			lines = append(lines, fmt.Sprintf("+ %s=%s", k, value(k, bv)))
+		case av != bv:
+			lines = append(lines, fmt.Sprintf("~ %s=%s -> %s", k, value(k, av), value(k, bv)))
+		}
+	}
+	if len(lines) == 0 {
+		return false
+	}
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", aName, bName)
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+	return true
+}
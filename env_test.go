@@ -0,0 +1,148 @@
+package main
+
+import "testing"
+
+func TestSetEnvVar(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		key, value string
+		want       string
+	}{
+		{
+			name:    "replaces in place",
+			content: "# App\nAPP_ENV=local\nAPP_DEBUG=true\n",
+			key:     "APP_ENV", value: "production",
+			want: "# App\nAPP_ENV=production\nAPP_DEBUG=true\n",
+		},
+		{
+			name:    "appends before trailing newline",
+			content: "APP_ENV=local\n\n# Mail\nMAIL_HOST=smtp\n",
+			key:     "QUEUE", value: "redis",
+			want: "APP_ENV=local\n\n# Mail\nMAIL_HOST=smtp\nQUEUE=redis\n",
+		},
+		{
+			name:    "appends without trailing newline",
+			content: "APP_ENV=local",
+			key:     "QUEUE", value: "redis",
+			want: "APP_ENV=local\nQUEUE=redis\n",
+		},
+		{
+			name:    "replaces a multiline value",
+			content: "A=1\nKEY=\"-----BEGIN\nabc\n-----END\"\nB=2\n",
+			key:     "KEY", value: "new",
+			want: "A=1\nKEY=new\nB=2\n",
+		},
+		{
+			name:    "keeps other multiline values",
+			content: "KEY=\"line 1\nB=not a key\"\nA=1\n",
+			key:     "B", value: "2",
+			want: "KEY=\"line 1\nB=not a key\"\nA=1\nB=2\n",
+		},
+		{
+			name:    "keeps export and comments",
+			content: "export A=1 # one\nB='x y'  # why\nC=\"a\\\"#b\" #c\nD=e#f\n",
+			key:     "A", value: "2",
+			want: "export A=2 # one\nB='x y'  # why\nC=\"a\\\"#b\" #c\nD=e#f\n",
+		},
+		{
+			name:    "keeps the comment of a quoted value",
+			content: "B='x y'  # why\n",
+			key:     "B", value: "z",
+			want: "B=z  # why\n",
+		},
+		{
+			name:    "keeps the comment of a value with escaped quotes",
+			content: "C=\"a\\\"#b\" #c\n",
+			key:     "C", value: "d",
+			want: "C=d #c\n",
+		},
+		{
+			name:    "keeps hashes inside unquoted values",
+			content: "D=e#f\n",
+			key:     "D", value: "g",
+			want: "D=g\n",
+		},
+		{
+			name:    "keeps the comment after a multiline value",
+			content: "export KEY=\"a\nb\" # pem\n",
+			key:     "KEY", value: "new",
+			want: "export KEY=new # pem\n",
+		},
+		{
+			name:    "keeps CRLF",
+			content: "# App\r\nAPP_ENV=local\r\nAPP_DEBUG=true\r\n",
+			key:     "APP_ENV", value: "production",
+			want: "# App\r\nAPP_ENV=production\r\nAPP_DEBUG=true\r\n",
+		},
+		{
+			name:    "appends with CRLF",
+			content: "APP_ENV=local\r\n",
+			key:     "QUEUE", value: "redis",
+			want: "APP_ENV=local\r\nQUEUE=redis\r\n",
+		},
+		{
+			name:    "quotes values",
+			content: "",
+			key:     "NAME", value: "My App",
+			want: "NAME='My App'\n",
+		},
+		{
+			name:    "escapes values with quotes and line breaks",
+			content: "",
+			key:     "KEY", value: "it's\n$secret",
+			want: "KEY=\"it's\\n\\$secret\"\n",
+		},
+	}
+	for _, test := range tests {
+		got := setEnvVar(test.content, test.key, test.value)
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestUnsetEnvVar(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		key     string
+		want    string
+		removed bool
+	}{
+		{
+			name:    "removes the assignment",
+			content: "# App\nAPP_ENV=local\nAPP_DEBUG=true\n",
+			key:     "APP_DEBUG",
+			want:    "# App\nAPP_ENV=local\n",
+			removed: true,
+		},
+		{
+			name:    "removes a multiline value",
+			content: "A=1\nKEY='-----BEGIN\nabc\n-----END'\n# B\nB=2\n",
+			key:     "KEY",
+			want:    "A=1\n# B\nB=2\n",
+			removed: true,
+		},
+		{
+			name:    "removes exported assignments with CRLF",
+			content: "A=1\r\nexport KEY=x\r\nB=2\r\n",
+			key:     "KEY",
+			want:    "A=1\r\nB=2\r\n",
+			removed: true,
+		},
+		{
+			name:    "leaves comments mentioning the key",
+			content: "# KEY=old\nA=1\n",
+			key:     "KEY",
+			want:    "# KEY=old\nA=1\n",
+			removed: false,
+		},
+	}
+	for _, test := range tests {
+		got, removed := unsetEnvVar(test.content, test.key)
+		if got != test.want || removed != test.removed {
+			t.Errorf("%s: got %q, %v, want %q, %v", test.name, got, removed, test.want, test.removed)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zippoxer/george/forge"
+)
+
+// execTarget is a server to run a command on, or a site to run it in the
+// directory of.
+type execTarget struct {
+	Server *forge.Server
+	Site   *forge.Site
+}
+
+func (t execTarget) name() string {
+	if t.Site != nil {
+		return t.Site.Name
+	}
+	return t.Server.Name
+}
+
+// ExecTargets returns every server or site best matching pattern. Sites
+// are left out when their server matches too.
+func (g *George) ExecTargets(ctx context.Context, pattern string) ([]execTarget, error) {
+	pattern = g.resolveAlias(pattern)
+	serverPattern, sitePattern, err := compileSearchPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	results, err := g.searchResults(ctx, serverPattern, sitePattern, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("No server or site matches %q.", pattern)
+	}
+	best := bestSearchResults(results)
+	if best[0].score == scoreSubsequence {
+		return nil, looseMatchError(pattern, best)
+	}
+	servers := make(map[int]bool)
+	for _, result := range best {
+		if result.Site == nil {
+			servers[result.Server.Id] = true
+		}
+	}
+	var targets []execTarget
+	for _, result := range best {
+		if result.Site != nil && servers[result.Server.Id] {
+			continue
+		}
+		targets = append(targets, execTarget{Server: result.Server, Site: result.Site})
+	}
+	return targets, nil
+}
+
+// execResult is the outcome of running a command on a target.
+type execResult struct {
+	target   execTarget
+	code     int
+	err      error
+	duration time.Duration
+}
+
+func (r execResult) failed() bool {
+	return r.err != nil || r.code != 0
+}
+
+// Exec runs command on every target, at most concurrency at a time, and
+// returns the results in the order of targets. Output lines are prefixed
+// with the name of their target.
+func (g *George) Exec(ctx context.Context, targets []execTarget, command string, concurrency int, stdout, stderr io.Writer) []execResult {
+	width := 0
+	for _, t := range targets {
+		if len(t.name()) > width {
+			width = len(t.name())
+		}
+	}
+	var mu sync.Mutex
+	results := make([]execResult, len(targets))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		prefix := colorize(prefixColors[i%len(prefixColors)], fmt.Sprintf("%-*s", width, t.name())) + " | "
+		wg.Add(1)
+		go func(i int, t execTarget) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				results[i] = execResult{target: t, err: ctx.Err()}
+				return
+			}
+			defer func() { <-sem }()
+
+			out := &prefixWriter{w: stdout, mu: &mu, prefix: prefix}
+			errOut := &prefixWriter{w: stderr, mu: &mu, prefix: prefix}
+			start := time.Now()
+			code, err := g.execOn(ctx, t, command, out, errOut)
+			out.Flush()
+			errOut.Flush()
+			if err != nil {
+				errOut.Write([]byte(err.Error() + "\n"))
+			}
+			results[i] = execResult{target: t, code: code, err: err, duration: time.Since(start)}
+		}(i, t)
+	}
+	wg.Wait()
+	return results
+}
+
+// execOn runs command on the server of t, in the site's directory if t is
+// a site, and returns its exit code.
+func (g *George) execOn(ctx context.Context, t execTarget, command string, stdout, stderr io.Writer) (int, error) {
+	client, release, err := g.pooledSSHClient(ctx, t.Server.Id)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	session.Stdout = stdout
+	session.Stderr = stderr
+	if t.Site != nil {
+		command = fmt.Sprintf("cd %s && %s", shellQuote(t.Site.Name), command)
+	}
+	if err := session.Start(command); err != nil {
+		return 0, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+	return exitCode(session.Wait())
+}
+
+// printExecSummary prints the exit code of every target, and returns the
+// number of targets that failed.
+func printExecSummary(w io.Writer, results []execResult) int {
+	failed := 0
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tEXIT\tTIME")
+	for _, r := range results {
+		status := fmt.Sprint(r.code)
+		color := colorGreen
+		if r.err != nil {
+			status = "error"
+		}
+		if r.failed() {
+			color = colorRed
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.target.name(), colorize(color, status),
+			r.duration.Round(time.Millisecond*100))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "%d of %d succeeded.\n", len(results)-failed, len(results))
+	return failed
+}
+
+// prefixWriter writes whole lines to w, each prefixed with prefix. Writers
+// sharing mu don't interleave their lines.
+type prefixWriter struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes what's left of an unterminated last line.
+func (p *prefixWriter) Flush() {
+	if len(p.buf) > 0 {
+		p.writeLine(append(p.buf, '\n'))
+		p.buf = nil
+	}
+}
+
+func (p *prefixWriter) writeLine(line []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	io.WriteString(p.w, p.prefix+strings.TrimRight(string(line), "\r\n")+"\n")
+}
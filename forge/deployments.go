@@ -0,0 +1,203 @@
+package forge
+
+import (
+	"context"
+	"fmt"
+)
+
+type Deployment struct {
+	Id              int    `json:"id"`
+	ServerId        int    `json:"server_id"`
+	SiteId          int    `json:"site_id"`
+	Type            int    `json:"type"`
+	CommitHash      string `json:"commit_hash"`
+	CommitAuthor    string `json:"commit_author"`
+	CommitMessage   string `json:"commit_message"`
+	StartedAt       string `json:"started_at"`
+	EndedAt         string `json:"ended_at"`
+	Status          string `json:"status"`
+	DisplayableType string `json:"displayable_type"`
+}
+
+// Done reports whether the deployment has either finished or failed.
+func (d *Deployment) Done() bool {
+	switch d.Status {
+	case "", "queued", "pending", "deploying":
+		return false
+	}
+	return true
+}
+
+// Failed reports whether the deployment is done but didn't finish successfully.
+func (d *Deployment) Failed() bool {
+	return d.Done() && d.Status != "finished"
+}
+
+type Deployments struct {
+	serverId int
+	siteId   int
+	c        *Client
+}
+
+func (d *Deployments) path(format string, a ...interface{}) string {
+	return fmt.Sprintf("/servers/%d/sites/%d", d.serverId, d.siteId) + fmt.Sprintf(format, a...)
+}
+
+type deployResponse struct {
+	Site Site
+}
+
+// Deploy triggers a deployment of the site.
+func (d *Deployments) Deploy() (*Site, error) {
+	return d.DeployContext(context.Background())
+}
+
+func (d *Deployments) DeployContext(ctx context.Context) (*Site, error) {
+	req := NewRequest("POST", d.path("/deployment/deploy"), nil)
+	var resp deployResponse
+	err := d.c.Do(ctx, req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	resp.Site.ServerId = d.serverId
+	return &resp.Site, nil
+}
+
+type deploymentsListResponse struct {
+	Deployments []Deployment
+}
+
+// List returns the deployment history of the site, newest first.
+func (d *Deployments) List() ([]Deployment, error) {
+	return d.ListContext(context.Background())
+}
+
+func (d *Deployments) ListContext(ctx context.Context) ([]Deployment, error) {
+	req := NewRequest("GET", d.path("/deployment-history"), nil)
+	var resp deploymentsListResponse
+	err := d.c.Do(ctx, req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Deployments, nil
+}
+
+type deploymentsGetResponse struct {
+	Deployment Deployment
+}
+
+func (d *Deployments) Get(id int) (*Deployment, error) {
+	return d.GetContext(context.Background(), id)
+}
+
+func (d *Deployments) GetContext(ctx context.Context, id int) (*Deployment, error) {
+	req := NewRequest("GET", d.path("/deployment-history/%d", id), nil)
+	var resp deploymentsGetResponse
+	err := d.c.Do(ctx, req, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Deployment, nil
+}
+
+type deploymentsOutputResponse struct {
+	Output string
+}
+
+// Output returns the output of the given deployment so far.
+func (d *Deployments) Output(id int) (string, error) {
+	return d.OutputContext(context.Background(), id)
+}
+
+func (d *Deployments) OutputContext(ctx context.Context, id int) (string, error) {
+	req := NewRequest("GET", d.path("/deployment-history/%d/output", id), nil)
+	var resp deploymentsOutputResponse
+	err := d.c.Do(ctx, req, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.Output, nil
+}
+
+// Log returns the output of the latest deployment.
+func (d *Deployments) Log() (string, error) {
+	return d.LogContext(context.Background())
+}
+
+func (d *Deployments) LogContext(ctx context.Context) (string, error) {
+	req := NewRequest("GET", d.path("/deployment/log"), nil)
+	var log []byte
+	err := d.c.Do(ctx, req, &log)
+	if err != nil {
+		return "", err
+	}
+	return string(log), nil
+}
+
+// Script returns the deploy script of the site.
+func (d *Deployments) Script() (string, error) {
+	return d.ScriptContext(context.Background())
+}
+
+func (d *Deployments) ScriptContext(ctx context.Context) (string, error) {
+	req := NewRequest("GET", d.path("/deployment/script"), nil)
+	var script []byte
+	err := d.c.Do(ctx, req, &script)
+	if err != nil {
+		return "", err
+	}
+	return string(script), nil
+}
+
+type updateScriptRequest struct {
+	Content string `json:"content"`
+}
+
+// UpdateScript replaces the deploy script of the site with content.
+func (d *Deployments) UpdateScript(content string) error {
+	return d.UpdateScriptContext(context.Background(), content)
+}
+
+func (d *Deployments) UpdateScriptContext(ctx context.Context, content string) error {
+	req := NewRequest("PUT", d.path("/deployment/script"), updateScriptRequest{
+		Content: content,
+	})
+	return d.c.Do(ctx, req, nil)
+}
+
+// EnableQuickDeploy makes Forge deploy the site whenever its branch is pushed to.
+func (d *Deployments) EnableQuickDeploy() error {
+	return d.EnableQuickDeployContext(context.Background())
+}
+
+func (d *Deployments) EnableQuickDeployContext(ctx context.Context) error {
+	return d.c.Do(ctx, NewRequest("POST", d.path("/deployment"), nil), nil)
+}
+
+func (d *Deployments) DisableQuickDeploy() error {
+	return d.DisableQuickDeployContext(context.Background())
+}
+
+func (d *Deployments) DisableQuickDeployContext(ctx context.Context) error {
+	return d.c.Do(ctx, NewRequest("DELETE", d.path("/deployment"), nil), nil)
+}
+
+// Latest returns the latest deployment of the site, or nil if it was never
+// deployed.
+func (d *Deployments) Latest() (*Deployment, error) {
+	return d.LatestContext(context.Background())
+}
+
+func (d *Deployments) LatestContext(ctx context.Context) (*Deployment, error) {
+	deployments, err := d.ListContext(ctx)
+	if err != nil || len(deployments) == 0 {
+		return nil, err
+	}
+	latest := &deployments[0]
+	for i := range deployments {
+		if deployments[i].Id > latest.Id {
+			latest = &deployments[i]
+		}
+	}
+	return latest, nil
+}
@@ -3,7 +3,6 @@ package forge
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"github.com/joho/godotenv"
 )
@@ -25,19 +24,56 @@ type Env struct {
 	c        *Client
 }
 
+func (e *Env) path() string {
+	return fmt.Sprintf("/servers/%d/sites/%d/env", e.serverId, e.siteId)
+}
+
 func (e *Env) Get() (DotEnv, error) {
-	req := &Request{
-		Method: "GET",
-		Path:   fmt.Sprintf("/servers/%d/sites/%d/env", e.serverId, e.siteId),
-	}
-	var env []byte
-	err := e.c.Do(context.Background(), req, &env)
+	return e.GetContext(context.Background())
+}
+
+func (e *Env) GetContext(ctx context.Context) (DotEnv, error) {
+	content, err := e.ContentContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	m, err := godotenv.Unmarshal(string(env))
+	m, err := godotenv.Unmarshal(content)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	return DotEnv(m), nil
 }
+
+// Content returns the .env file of the site as is, including comments.
+func (e *Env) Content() (string, error) {
+	return e.ContentContext(context.Background())
+}
+
+func (e *Env) ContentContext(ctx context.Context) (string, error) {
+	req := &Request{
+		Method: "GET",
+		Path:   e.path(),
+	}
+	var env []byte
+	err := e.c.Do(ctx, req, &env)
+	if err != nil {
+		return "", err
+	}
+	return string(env), nil
+}
+
+type updateEnvRequest struct {
+	Content string `json:"content"`
+}
+
+// Update replaces the .env file of the site with content.
+func (e *Env) Update(content string) error {
+	return e.UpdateContext(context.Background(), content)
+}
+
+func (e *Env) UpdateContext(ctx context.Context, content string) error {
+	req := NewRequest("PUT", e.path(), updateEnvRequest{
+		Content: content,
+	})
+	return e.c.Do(ctx, req, nil)
+}
@@ -0,0 +1,142 @@
+package forge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrBadRequest      = errors.New("Valid data was given but the request has failed.")
+	ErrInvalidAPIKey   = errors.New("No valid API Key was given.")
+	ErrNotFound        = errors.New("The request resource could not be found.")
+	ErrInvalidData     = errors.New("The payload has missing required parameters or invalid data was given.")
+	ErrTooManyAttempts = errors.New("Too many attempts.")
+	ErrInternal        = errors.New("Request failed due to an internal error in Forge.")
+	ErrMaintenance     = errors.New("Forge is offline for maintenance.")
+)
+
+// APIError is returned when Forge responds with a non-200 status code.
+//
+// It wraps one of the Err* errors above, so errors.Is(err, ErrNotFound)
+// works as expected.
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+
+	// Body is the raw response body.
+	Body []byte
+
+	// Message is the message Forge returned, if any.
+	Message string
+
+	// Errors maps each rejected field to Forge's validation messages.
+	Errors map[string][]string
+
+	// RetryAfter is how long Forge asked us to wait before retrying,
+	// or zero if it didn't say.
+	RetryAfter time.Duration
+
+	err error
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	if e.Message != "" {
+		b.WriteString(e.Message)
+	} else {
+		b.WriteString(e.err.Error())
+	}
+	fields := make([]string, 0, len(e.Errors))
+	for field := range e.Errors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		for _, msg := range e.Errors[field] {
+			fmt.Fprintf(&b, "\n  %s: %s", field, msg)
+		}
+	}
+	return b.String()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.err
+}
+
+// validationResponse is the body of Forge's 422 responses, which come in
+// two shapes: {"message": ..., "errors": {field: [...]}} and {field: [...]}.
+type validationResponse struct {
+	Message string              `json:"message"`
+	Errors  map[string][]string `json:"errors"`
+}
+
+func newAPIError(req *Request, resp *http.Response) *APIError {
+	// A partially read body is still worth reporting.
+	body, _ := ioutil.ReadAll(resp.Body)
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     req.Method,
+		Path:       req.Path,
+		Body:       body,
+		RetryAfter: retryAfter(resp.Header),
+		err:        forgeError(resp.StatusCode),
+	}
+	var v validationResponse
+	if json.Unmarshal(body, &v) == nil {
+		e.Message = v.Message
+		e.Errors = v.Errors
+	}
+	if e.Errors == nil && resp.StatusCode == 422 {
+		var fields map[string][]string
+		if json.Unmarshal(body, &fields) == nil {
+			e.Errors = fields
+		}
+	}
+	return e
+}
+
+// retryAfter parses the Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func retryAfter(h http.Header) time.Duration {
+	s := h.Get("Retry-After")
+	if s == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func forgeError(statusCode int) error {
+	switch statusCode {
+	case 400:
+		return ErrBadRequest
+	case 401:
+		return ErrInvalidAPIKey
+	case 404:
+		return ErrNotFound
+	case 422:
+		return ErrInvalidData
+	case 429:
+		return ErrTooManyAttempts
+	case 500:
+		return ErrInternal
+	case 503:
+		return ErrMaintenance
+	}
+	return fmt.Errorf("unknown status code %d returned", statusCode)
+}
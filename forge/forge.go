@@ -4,25 +4,19 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 )
 
 const URL = "https://forge.laravel.com/api/v1"
 
-var (
-	ErrBadRequest      = errors.New("Valid data was given but the request has failed.")
-	ErrInvalidAPIKey   = errors.New("No valid API Key was given.")
-	ErrNotFound        = errors.New("The request resource could not be found.")
-	ErrInvalidData     = errors.New("The payload has missing required parameters or invalid data was given.")
-	ErrTooManyAttempts = errors.New("Too many attempts.")
-	ErrInternal        = errors.New("Request failed due to an internal error in Forge.")
-	ErrMaintenance     = errors.New("Forge is offline for maintenance.")
-)
+// RequestsPerMinute is the number of requests Forge allows per API key
+// every minute.
+const RequestsPerMinute = 60
 
 type Time struct {
 	time.Time
@@ -38,17 +32,99 @@ func (t *Time) UnmarshalJSON(b []byte) error {
 }
 
 type Client struct {
-	apiKey string
-	hc     *http.Client
+	apiKey     string
+	baseURL    string
+	userAgent  string
+	hc         *http.Client
+	limiter    *RateLimiter
+	maxRetries int
+
+	// transport and timeout override those of hc, without modifying it.
+	transport http.RoundTripper
+	timeout   time.Duration
+}
+
+// Option configures a Client created with New.
+type Option func(*Client)
+
+// WithBaseURL makes the client send requests to url instead of URL.
+// It's useful for pointing the client at a proxy or a mock of Forge.
+func WithBaseURL(url string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(url, "/")
+	}
+}
+
+// WithHTTPClient makes the client send requests using hc. WithTransport and
+// WithTimeout apply to a copy of hc, regardless of their order.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.hc = hc
+	}
+}
+
+// WithTransport makes the client send requests using the given transport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = rt
+	}
+}
+
+// WithUserAgent sets the User-Agent header of every request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
 }
 
-func New(apiKey string) *Client {
-	return &Client{
-		apiKey: apiKey,
-		hc:     &http.Client{},
+// WithRateLimiter makes the client wait for l before sending each request.
+// Passing nil disables client-side rate limiting.
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(c *Client) {
+		c.limiter = l
 	}
 }
 
+// WithRetries sets how many times a failed request is retried. Throttled
+// requests are always retried, while server and connection errors are
+// retried only for idempotent requests.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		c.maxRetries = n
+	}
+}
+
+// WithTimeout limits the time a single request may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+func New(apiKey string, opts ...Option) *Client {
+	c := &Client{
+		apiKey:     apiKey,
+		baseURL:    URL,
+		hc:         &http.Client{},
+		limiter:    NewRateLimiter(RequestsPerMinute, RequestsPerMinute),
+		maxRetries: 3,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.transport != nil || c.timeout != 0 {
+		hc := *c.hc
+		if c.transport != nil {
+			hc.Transport = c.transport
+		}
+		if c.timeout != 0 {
+			hc.Timeout = c.timeout
+		}
+		c.hc = &hc
+	}
+	return c
+}
+
 func (c *Client) Servers() *Servers {
 	return &Servers{c: c}
 }
@@ -69,39 +145,102 @@ func (c *Client) Env(serverId, siteId int) *Env {
 	}
 }
 
+func (c *Client) Deployments(serverId, siteId int) *Deployments {
+	return &Deployments{
+		c:        c,
+		serverId: serverId,
+		siteId:   siteId,
+	}
+}
+
 func (c *Client) Do(ctx context.Context, req *Request, result interface{}) error {
-	var body io.Reader
+	var body []byte
 	if req.Body != nil {
 		b, err := json.Marshal(req.Body)
 		if err != nil {
 			return err
 		}
-		body = bytes.NewReader(b)
+		body = b
+	}
+	for attempt := 0; ; attempt++ {
+		if c.limiter != nil {
+			if err := c.limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		resp, err := c.send(ctx, req, body)
+		if err != nil {
+			// Connection errors are retried only if repeating the request
+			// is harmless, since it might have reached Forge.
+			if ctx.Err() != nil || attempt >= c.maxRetries || !req.idempotent() {
+				return err
+			}
+			if err := sleep(ctx, backoff(attempt)); err != nil {
+				return err
+			}
+			continue
+		}
+		if resp.StatusCode == 200 {
+			defer resp.Body.Close()
+			return decodeResult(resp.Body, result)
+		}
+		apiErr := newAPIError(req, resp)
+		resp.Body.Close()
+		if attempt >= c.maxRetries {
+			return apiErr
+		}
+		var wait time.Duration
+		switch {
+		case resp.StatusCode == 429:
+			// Throttled requests were never processed, so any method may
+			// be retried.
+			wait = apiErr.RetryAfter
+			if wait == 0 {
+				wait = rateLimitReset(resp.Header)
+			}
+			if wait == 0 {
+				wait = backoff(attempt)
+			}
+		case resp.StatusCode >= 500 && req.idempotent():
+			wait = backoff(attempt)
+		default:
+			return apiErr
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
 	}
-	httpReq, err := http.NewRequest(req.Method, URL+req.Path, body)
+}
+
+func (c *Client) send(ctx context.Context, req *Request, body []byte) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequest(req.Method, c.baseURL+req.Path, r)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	httpReq = httpReq.WithContext(ctx)
 	httpReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
 	httpReq.Header.Set("Accept", "application/json")
 	httpReq.Header.Set("Content-Type", "application/json")
-	resp, err := c.hc.Do(httpReq)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return forgeError(resp.StatusCode)
+	if c.userAgent != "" {
+		httpReq.Header.Set("User-Agent", c.userAgent)
 	}
+	return c.hc.Do(httpReq)
+}
+
+func decodeResult(body io.Reader, result interface{}) error {
 	switch r := result.(type) {
 	case nil:
 		return nil
 	case *[]byte:
-		*r, err = ioutil.ReadAll(resp.Body)
+		var err error
+		*r, err = ioutil.ReadAll(body)
 		return err
 	}
-	return json.NewDecoder(resp.Body).Decode(result)
+	return json.NewDecoder(body).Decode(result)
 }
 
 type Request struct {
@@ -110,6 +249,16 @@ type Request struct {
 	Body   interface{}
 }
 
+// idempotent reports whether sending the request twice has the same effect
+// as sending it once.
+func (r *Request) idempotent() bool {
+	switch r.Method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
 func NewRequest(method, path string, body interface{}) *Request {
 	return &Request{
 		Method: method,
@@ -117,23 +266,3 @@ func NewRequest(method, path string, body interface{}) *Request {
 		Body:   body,
 	}
 }
-
-func forgeError(statusCode int) error {
-	switch statusCode {
-	case 400:
-		return ErrBadRequest
-	case 401:
-		return ErrInvalidAPIKey
-	case 404:
-		return ErrNotFound
-	case 422:
-		return ErrInvalidData
-	case 429:
-		return ErrTooManyAttempts
-	case 500:
-		return ErrInternal
-	case 503:
-		return ErrMaintenance
-	}
-	return fmt.Errorf("unknown status code %d returned", statusCode)
-}
@@ -0,0 +1,91 @@
+package forge
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client of a Forge mock served by handler, which
+// retries once and doesn't rate limit itself. The mock must be closed.
+func newTestClient(handler http.HandlerFunc) (*Client, *httptest.Server) {
+	srv := httptest.NewServer(handler)
+	return New("key", WithBaseURL(srv.URL), WithRateLimiter(nil), WithRetries(1)), srv
+}
+
+func TestDoRetriesThrottledRequests(t *testing.T) {
+	var calls int32
+	c, srv := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(429)
+			return
+		}
+		w.Write([]byte(`{"servers": [{"id": 1, "name": "web"}]}`))
+	})
+	defer srv.Close()
+
+	start := time.Now()
+	servers, err := c.Servers().List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want at least the 1s of Retry-After", elapsed)
+	}
+	if calls != 2 {
+		t.Errorf("got %d requests, want 2", calls)
+	}
+	if len(servers) != 1 || servers[0].Name != "web" {
+		t.Errorf("got servers %+v", servers)
+	}
+}
+
+func TestDoRetriesServerErrorsOfIdempotentRequests(t *testing.T) {
+	tests := []struct {
+		method string
+		calls  int32
+	}{
+		{"GET", 2},
+		{"DELETE", 2},
+		{"POST", 1},
+	}
+	for _, test := range tests {
+		var calls int32
+		c, srv := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&calls, 1)
+			w.WriteHeader(500)
+		})
+		err := c.Do(context.Background(), NewRequest(test.method, "/servers", nil), nil)
+		srv.Close()
+		if !errors.Is(err, ErrInternal) {
+			t.Errorf("%s: got error %v, want ErrInternal", test.method, err)
+		}
+		if calls != test.calls {
+			t.Errorf("%s: got %d requests, want %d", test.method, calls, test.calls)
+		}
+	}
+}
+
+func TestDoStopsWhenContextIsDone(t *testing.T) {
+	c, srv := newTestClient(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(429)
+	})
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := c.Do(ctx, NewRequest("GET", "/servers", nil), nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %v, instead of once the context was done", elapsed)
+	}
+}
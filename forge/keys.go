@@ -27,12 +27,16 @@ type keysCreateResponse struct {
 }
 
 func (k *Keys) Create(name, key string) (*Key, error) {
+	return k.CreateContext(context.Background(), name, key)
+}
+
+func (k *Keys) CreateContext(ctx context.Context, name, key string) (*Key, error) {
 	req := NewRequest("POST", fmt.Sprintf("/servers/%d/keys", k.serverId), createKeyRequest{
 		Name: name,
 		Key:  key,
 	})
 	var resp keysCreateResponse
-	err := k.c.Do(context.Background(), req, &resp)
+	err := k.c.Do(ctx, req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -44,9 +48,13 @@ type keysListResponse struct {
 }
 
 func (k *Keys) List() ([]Key, error) {
+	return k.ListContext(context.Background())
+}
+
+func (k *Keys) ListContext(ctx context.Context) ([]Key, error) {
 	req := NewRequest("GET", fmt.Sprintf("/servers/%d/keys", k.serverId), nil)
 	var resp keysListResponse
-	err := k.c.Do(context.Background(), req, &resp)
+	err := k.c.Do(ctx, req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -58,11 +66,24 @@ type keysGetResponse struct {
 }
 
 func (k *Keys) Get(id int) (*Key, error) {
+	return k.GetContext(context.Background(), id)
+}
+
+func (k *Keys) GetContext(ctx context.Context, id int) (*Key, error) {
 	req := NewRequest("GET", fmt.Sprintf("/servers/%d/keys/%d", k.serverId, id), nil)
 	var resp keysGetResponse
-	err := k.c.Do(context.Background(), req, &resp)
+	err := k.c.Do(ctx, req, &resp)
 	if err != nil {
 		return nil, err
 	}
 	return &resp.Key, nil
 }
+
+func (k *Keys) Delete(id int) error {
+	return k.DeleteContext(context.Background(), id)
+}
+
+func (k *Keys) DeleteContext(ctx context.Context, id int) error {
+	req := NewRequest("DELETE", fmt.Sprintf("/servers/%d/keys/%d", k.serverId, id), nil)
+	return k.c.Do(ctx, req, nil)
+}
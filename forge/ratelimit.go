@@ -0,0 +1,94 @@
+package forge
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket shared by every request of the clients
+// it's given to, so that fanning out requests doesn't get us throttled.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens added per second.
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing perMinute requests every
+// minute, and up to burst requests at once.
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:   float64(perMinute) / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be sent or ctx is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	// Take the token right away, even if it's not there yet, so that
+	// concurrent waiters queue up behind each other.
+	l.tokens--
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if wait == 0 {
+		return nil
+	}
+	if err := sleep(ctx, wait); err != nil {
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// backoff returns how long to wait before the given retry attempt,
+// doubling each attempt and jittered to spread out concurrent retries.
+func backoff(attempt int) time.Duration {
+	d := 500 * time.Millisecond << uint(attempt)
+	if max := 30 * time.Second; d > max {
+		d = max
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// rateLimitReset returns the time until the X-RateLimit-Reset header,
+// a unix timestamp, or zero if it's missing or passed.
+func rateLimitReset(h http.Header) time.Duration {
+	reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	if d := time.Until(time.Unix(reset, 0)); d > 0 {
+		return d
+	}
+	return 0
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
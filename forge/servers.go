@@ -30,12 +30,16 @@ type serversListResponse struct {
 }
 
 func (s *Servers) List() ([]Server, error) {
+	return s.ListContext(context.Background())
+}
+
+func (s *Servers) ListContext(ctx context.Context) ([]Server, error) {
 	req := &Request{
 		Method: "GET",
 		Path:   "/servers",
 	}
 	var resp serversListResponse
-	err := s.c.Do(context.Background(), req, &resp)
+	err := s.c.Do(ctx, req, &resp)
 	if err != nil {
 		return nil, err
 	}
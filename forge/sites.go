@@ -17,7 +17,9 @@ type Site struct {
 	RepositoryBranch   string      `json:"repository_branch"`
 	RepositoryStatus   string      `json:"repository_status"`
 	QuickDeploy        bool        `json:"quick_deploy"`
+	DeploymentStatus   string      `json:"deployment_status"`
 	ProjectType        string      `json:"project_type"`
+	PhpVersion         string      `json:"php_version"`
 	App                interface{} `json:"app"`
 	AppStatus          interface{} `json:"app_status"`
 	HipchatRoom        interface{} `json:"hipchat_room"`
@@ -35,9 +37,13 @@ type sitesListResponse struct {
 }
 
 func (s *Sites) List() ([]Site, error) {
+	return s.ListContext(context.Background())
+}
+
+func (s *Sites) ListContext(ctx context.Context) ([]Site, error) {
 	req := NewRequest("GET", fmt.Sprintf("/servers/%d/sites", s.serverId), nil)
 	var resp sitesListResponse
-	err := s.c.Do(context.Background(), req, &resp)
+	err := s.c.Do(ctx, req, &resp)
 	if err != nil {
 		return nil, err
 	}
@@ -1,33 +1,52 @@
 package main
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/sha512"
-	"encoding/base32"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
-	"os"
-	"os/exec"
 	"os/user"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 
-	"github.com/gobwas/glob"
 	"github.com/zippoxer/george/forge"
 )
 
 type George struct {
 	client  *forge.Client
 	cache   *cache
+	config  *Config
 	homeDir string
+
+	// strictHostKeys refuses connecting to servers with unknown host keys,
+	// rather than trusting them on first use.
+	strictHostKeys bool
+
+	// identity is the private key file to use, or empty for the default.
+	identity string
+
+	// interactive lets the user pick among several matching servers or
+	// sites, rather than failing.
+	interactive bool
+
+	publicKey   []byte
+	publicKeyMu sync.Mutex
+	signers     []ssh.Signer
+	signersMu   sync.Mutex
+
+	// sshPool holds connections shared by commands running on the same
+	// server, by server id.
+	sshPool   map[int][]*sshPoolEntry
+	sshPoolMu sync.Mutex
 }
 
 func New(client *forge.Client, cacheMaxAge time.Duration) (*George, error) {
@@ -36,9 +55,15 @@ func New(client *forge.Client, cacheMaxAge time.Duration) (*George, error) {
 		panic(err)
 	}
 
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
 	g := &George{
 		client:  client,
 		cache:   newCache(client),
+		config:  config,
 		homeDir: usr.HomeDir,
 	}
 	if err := g.loadCache(cacheMaxAge); err != nil {
@@ -55,265 +80,227 @@ func (g *George) dumpCache() error {
 	return g.cache.Dump(filepath.Join(g.homeDir, ".george-cache"))
 }
 
-func (g *George) Search(pattern string) (*forge.Server, *forge.Site, error) {
-	serverGlob, siteGlob, err := g.compileSearchPattern(pattern)
+// Search finds the server or site best matching pattern, which is either an
+// alias, a server name, IP or site domain, or a "server:site" pair. When several
+// match equally well, the user picks one if interactive.
+func (g *George) Search(ctx context.Context, pattern string) (*forge.Server, *forge.Site, error) {
+	pattern = g.resolveAlias(pattern)
+	serverPattern, sitePattern, err := compileSearchPattern(pattern)
 	if err != nil {
 		return nil, nil, err
 	}
-	if siteGlob != nil {
-		return g.SearchSite(pattern)
+	if sitePattern != nil {
+		return g.SearchSite(ctx, pattern)
 	}
 
-	servers, err := g.cache.Servers()
+	// A server named exactly as the pattern needs no further searching,
+	// which saves listing the sites of every server.
+	servers, err := g.cache.Servers(ctx)
 	if err != nil {
 		return nil, nil, err
 	}
-	var matchingServers []forge.Server
+	var exact []forge.Server
 	for _, server := range servers {
-		if serverGlob.Match(server.Name) || serverGlob.Match(server.IPAddress) {
-			matchingServers = append(matchingServers, server)
-		}
-	}
-	if len(matchingServers) > 1 {
-		err = g.printServers(servers, serverGlob, siteGlob)
-		if err != nil {
-			return nil, nil, err
+		if serverPattern.glob == nil && serverScore(serverPattern, &server) == scoreExact {
+			exact = append(exact, server)
 		}
-		return nil, nil, fmt.Errorf("More than one server matches %q.", pattern)
 	}
-	if len(matchingServers) == 0 {
-		return g.SearchSite(pattern)
+	if len(exact) == 1 {
+		return &exact[0], nil, nil
 	}
-	return &matchingServers[0], nil, nil
-}
 
-func (g *George) SearchSite(pattern string) (*forge.Server, *forge.Site, error) {
-	serverGlob, siteGlob, err := g.compileSearchPattern(pattern)
+	results, err := g.searchResults(ctx, serverPattern, nil, true)
 	if err != nil {
 		return nil, nil, err
 	}
+	return g.chooseSearchResult(pattern, results)
+}
 
-	servers, err := g.cache.Servers()
+// SearchSite is like Search, but only finds sites.
+func (g *George) SearchSite(ctx context.Context, pattern string) (*forge.Server, *forge.Site, error) {
+	pattern = g.resolveAlias(pattern)
+	serverPattern, sitePattern, err := compileSearchPattern(pattern)
 	if err != nil {
 		return nil, nil, err
 	}
-	serverSites, err := g.cache.ServerSites(servers)
+	results, err := g.searchResults(ctx, serverPattern, sitePattern, false)
 	if err != nil {
 		return nil, nil, err
 	}
+	return g.chooseSearchResult(pattern, results)
+}
 
-	if err := g.dumpCache(); err != nil {
-		log.Printf("error dumping george cache: %v", err)
-	}
-
-	var matchingSites []forge.Site
-	for _, server := range serverSites {
-		if siteGlob != nil && !serverGlob.Match(server.Name) && !serverGlob.Match(server.IPAddress) {
-			continue
-		}
-		for _, site := range server.Sites {
-			if siteGlob == nil && serverGlob.Match(site.Name) ||
-				siteGlob != nil && siteGlob.Match(site.Name) {
-				matchingSites = append(matchingSites, site)
-			}
-		}
+// SearchSites returns every site best matching pattern, such as all the
+// sites matching a glob.
+func (g *George) SearchSites(ctx context.Context, pattern string) ([]searchResult, error) {
+	pattern = g.resolveAlias(pattern)
+	serverPattern, sitePattern, err := compileSearchPattern(pattern)
+	if err != nil {
+		return nil, err
 	}
-	if len(matchingSites) > 1 {
-		err = g.printServers(servers, serverGlob, siteGlob)
-		if err != nil {
-			return nil, nil, err
-		}
-		return nil, nil, fmt.Errorf("More than one site matches %q.", pattern)
+	results, err := g.searchResults(ctx, serverPattern, sitePattern, false)
+	if err != nil {
+		return nil, err
 	}
-	if len(matchingSites) == 0 {
-		err = g.printServers(servers, serverGlob, siteGlob)
-		if err != nil {
-			return nil, nil, err
-		}
-		return nil, nil, fmt.Errorf("Server or site not found.")
+	if len(results) == 0 {
+		return nil, fmt.Errorf("No site matches %q.", pattern)
 	}
-	site := &matchingSites[0]
-	var server *forge.Server
-	for _, s := range servers {
-		if s.Id == site.ServerId {
-			server = &s
-			break
-		}
+	best := bestSearchResults(results)
+	if best[0].score == scoreSubsequence {
+		return nil, looseMatchError(pattern, best)
 	}
-	if server == nil {
-		return nil, nil, fmt.Errorf("Site found, but it's server wasn't found. Seems like data is corrupt.")
-	}
-	return server, site, nil
+	return best, nil
 }
 
-func (g *George) compileSearchPattern(pattern string) (server, site glob.Glob, err error) {
-	var serverPat, sitePat string
-	patterns := strings.Split(strings.ToLower(pattern), ":")
-	if len(patterns) == 2 {
-		serverPat, sitePat = patterns[0], patterns[1]
-	} else {
-		serverPat, sitePat = patterns[0], ""
-	}
-	if serverPat == "" {
-		serverPat = "*"
-	}
-	server, err = glob.Compile(serverPat)
-	if err != nil {
-		return
-	}
-	if sitePat != "" {
-		site, err = glob.Compile(sitePat)
+// looseMatchError lists results matching pattern only by scattered letters,
+// which commands acting on every match refuse to act on.
+func looseMatchError(pattern string, results []searchResult) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "No server or site name contains %q, but it loosely matches:", pattern)
+	for _, result := range results {
+		fmt.Fprintf(&b, "\n  %s", result)
 	}
-	return
+	return errors.New(b.String())
+}
+
+// IsGlob reports whether pattern, or the pattern it's an alias of, is a
+// glob meant to match several servers or sites.
+func (g *George) IsGlob(pattern string) bool {
+	return strings.ContainsAny(g.resolveAlias(pattern), globChars)
 }
 
-func (g *George) printServers(servers []forge.Server, serverGlob, siteGlob glob.Glob) error {
-	fmt.Printf("Available servers:\n")
-	serverSites, err := g.cache.ServerSites(servers)
+// searchResults returns the sites, and the servers if withServers is set,
+// matching the given patterns, sorted from the best match to the worst.
+// If sitePattern is nil, serverPattern is matched against sites too.
+func (g *George) searchResults(ctx context.Context, serverPattern, sitePattern *namePattern, withServers bool) ([]searchResult, error) {
+	serverSites, err := g.cache.ServerSites(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	for _, server := range serverSites {
-		match := serverGlob == nil ||
-			serverGlob.Match(server.Name) ||
-			serverGlob.Match(server.IPAddress)
-		for _, site := range server.Sites {
-			if siteGlob == nil && serverGlob.Match(site.Name) ||
-				siteGlob != nil && siteGlob.Match(site.Name) {
-				match = true
-				break
-			}
+	if err := g.dumpCache(); err != nil {
+		log.Printf("error dumping george cache: %v", err)
+	}
+
+	var results []searchResult
+	for i := range serverSites {
+		server := &serverSites[i].Server
+		score := serverScore(serverPattern, server)
+		if sitePattern == nil && withServers && score > 0 {
+			results = append(results, searchResult{Server: server, score: score})
 		}
-		if match {
-			fmt.Printf("  %s (%s)\n", server.Name, server.IPAddress)
-			for _, site := range server.Sites {
-				if siteGlob == nil && serverGlob.Match(site.Name) ||
-					siteGlob != nil && siteGlob.Match(site.Name) {
-					fmt.Printf("    %s\n", site.Name)
-				}
+		if sitePattern != nil && score == 0 {
+			continue
+		}
+		for j := range serverSites[i].Sites {
+			site := &serverSites[i].Sites[j]
+			var score int
+			if sitePattern != nil {
+				score = sitePattern.Score(site.Name)
+			} else {
+				score = serverPattern.Score(site.Name)
+			}
+			if score > 0 {
+				results = append(results, searchResult{Server: server, Site: site, score: score})
 			}
 		}
 	}
-	return nil
+	sortSearchResults(results)
+	return results, nil
 }
 
-func (g *George) SSH(serverId int) (*ssh.Session, error) {
-	err := g.SSHInstallKey(serverId)
-	if err != nil {
-		return nil, err
+// chooseSearchResult returns the best of the given sorted results. If
+// several are equally good, the user picks one of all results when
+// interactive, and otherwise they're listed in an error.
+func (g *George) chooseSearchResult(pattern string, results []searchResult) (*forge.Server, *forge.Site, error) {
+	if len(results) == 0 {
+		return nil, nil, fmt.Errorf("Server or site not found.")
 	}
-	privateKeyBytes, err := g.sshPrivateKey()
-	if err != nil {
-		return nil, err
+	best := bestSearchResults(results)
+	// Scattered letters may match unexpected names, so a match by them is
+	// never chosen without asking, even if it's the only one.
+	if len(best) == 1 && best[0].score > scoreSubsequence {
+		return best[0].Server, best[0].Site, nil
 	}
-	privateKey, err := ssh.ParsePrivateKey(privateKeyBytes)
-	if err != nil {
-		return nil, err
+	title := fmt.Sprintf("More than one server or site matches %q:", pattern)
+	if len(best) == 1 {
+		title = fmt.Sprintf("No server or site name contains %q, but it loosely matches:", pattern)
 	}
-	config := &ssh.ClientConfig{
-		User: "forge",
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(privateKey),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
-	server, err := g.cache.Server(serverId)
-	if err != nil {
-		return nil, err
+	if g.interactive && canPick() {
+		items := make([]string, len(results))
+		for i, result := range results {
+			items[i] = result.String()
+		}
+		i, err := pick(title, items)
+		if err != nil {
+			return nil, nil, err
+		}
+		return results[i].Server, results[i].Site, nil
 	}
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:22", server.IPAddress), config)
-	if err != nil {
-		return nil, err
+	var b strings.Builder
+	b.WriteString(title)
+	for _, result := range best {
+		fmt.Fprintf(&b, "\n  %s", result)
 	}
-	return client.NewSession()
+	return nil, nil, errors.New(b.String())
 }
 
-// SSHInstallKey registers the public SSH key with the given forge server,
-// returning an error if installation failed.
-func (g *George) SSHInstallKey(serverId int) error {
-	publicKey, err := g.sshPublicKey()
+// MatchServerSites returns the servers and sites matching pattern. Servers
+// matching by name or IP come with all of their sites, while other servers
+// come only with their matching sites, if any. An empty pattern matches all.
+func (g *George) MatchServerSites(ctx context.Context, pattern string) ([]ServerSites, error) {
+	pattern = g.resolveAlias(pattern)
+	serverSites, err := g.cache.ServerSites(ctx, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	keyName := g.sshKeyName(publicKey)
-
-	keys, err := g.client.Keys(serverId).List()
+	if err := g.dumpCache(); err != nil {
+		log.Printf("error dumping george cache: %v", err)
+	}
+	sort.Slice(serverSites, func(i, j int) bool {
+		return serverSites[i].Name < serverSites[j].Name
+	})
+	if pattern == "" {
+		return serverSites, nil
+	}
+	serverPattern, sitePattern, err := compileSearchPattern(pattern)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	var key *forge.Key
-	for i := range keys {
-		if keys[i].Name == keyName {
-			key = &keys[i]
-			break
+	var matches []ServerSites
+	for _, server := range serverSites {
+		serverMatch := serverScore(serverPattern, &server.Server) > 0
+		if sitePattern == nil && serverMatch {
+			matches = append(matches, server)
+			continue
 		}
-	}
-	if key == nil {
-		key, err := g.client.Keys(serverId).Create(keyName, string(publicKey))
-		if err != nil {
-			return err
+		if sitePattern != nil && !serverMatch {
+			continue
 		}
-		for key.Status == "installing" {
-			key, err = g.client.Keys(serverId).Get(key.Id)
-			if err != nil {
-				return err
+		var sites []forge.Site
+		for _, site := range server.Sites {
+			if sitePattern == nil && serverPattern.Match(site.Name) ||
+				sitePattern != nil && sitePattern.Match(site.Name) {
+				sites = append(sites, site)
 			}
-			time.Sleep(time.Millisecond * 500)
 		}
-		if key.Status != "installed" {
-			return fmt.Errorf("failed installing SSH key: status is %v", key.Status)
+		if len(sites) > 0 {
+			matches = append(matches, ServerSites{Server: server.Server, Sites: sites})
 		}
 	}
-	return nil
+	return matches, nil
 }
 
-func (g *George) sshPrivateKey() ([]byte, error) {
-	filename := g.SSHPrivateKeyPath()
-	data, err := ioutil.ReadFile(filename)
-	if os.IsNotExist(err) || len(data) == 0 {
-		err = g.sshKeygen(filename)
-		if err != nil {
-			return nil, err
-		}
-		return g.sshPrivateKey()
+// sleep pauses for the given duration, returning early with an error
+// if ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return data, err
-}
-
-func (g *George) sshPublicKey() ([]byte, error) {
-	filename := g.SSHPrivateKeyPath()
-	filenamePub := g.SSHPublicKeyPath()
-	data, err := ioutil.ReadFile(filenamePub)
-	if os.IsNotExist(err) || len(data) == 0 {
-		err = g.sshKeygen(filename)
-		if err != nil {
-			return nil, err
-		}
-		return g.sshPublicKey()
-	}
-	return data, err
-}
-
-func (g *George) sshKeygen(privateKeyPath string) error {
-	fmt.Println("Generating an SSH key...")
-	// -N="" means empty password.
-	_, err := exec.Command("ssh-keygen", "-N", "", "-f", privateKeyPath).CombinedOutput()
-	return err
-}
-
-// sshKeyName returns a unique, irreversible and reproducible name for the given SSH key.
-func (s *George) sshKeyName(key []byte) string {
-	sum := sha512.Sum512_224(key)
-	sumStr := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(sum[:])
-	return "george-" + sumStr
-}
-
-func (g *George) SSHPrivateKeyPath() string {
-	return filepath.Join(g.homeDir, ".ssh", "id_rsa")
-}
-
-func (g *George) SSHPublicKeyPath() string {
-	return g.SSHPrivateKeyPath() + ".pub"
 }
 
 // Encrypt encrypts data using 256-bit AES-GCM.  This both hides the content of
@@ -13,8 +13,9 @@ require (
 	github.com/stretchr/objx v0.1.1 // indirect
 	github.com/stretchr/testify v1.3.0 // indirect
 	github.com/zippoxer/kingpin v0.0.0-20190326215213-8c683705940e
-	golang.org/x/crypto v0.0.0-20190211182817-74369b46fc67
-	golang.org/x/sys v0.0.0-20190318195719-6c81ef8f67ca // indirect
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d
+	gopkg.in/yaml.v2 v2.2.2
 )
 
 go 1.13
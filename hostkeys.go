@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/zippoxer/george/forge"
+)
+
+// KnownHostsPath returns the path of the known_hosts file george adds host
+// keys to when it connects to a server for the first time.
+func (g *George) KnownHostsPath() string {
+	return filepath.Join(g.homeDir, ".george-known_hosts")
+}
+
+// knownHostsFiles returns the known_hosts files that exist, starting with
+// OpenSSH's own.
+func (g *George) knownHostsFiles() []string {
+	var files []string
+	for _, f := range []string{
+		filepath.Join(g.homeDir, ".ssh", "known_hosts"),
+		g.KnownHostsPath(),
+	} {
+		if _, err := os.Stat(f); err == nil {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// hostKeyConfig sets up config to verify the host key of the given server.
+//
+// Host keys are trusted on first use and added to KnownHostsPath, unless
+// g.strictHostKeys is set. A host key that doesn't match the known one
+// fails the connection. Servers are always connected to by the IP address
+// Forge reports, so host keys are pinned to that address rather than to
+// whatever a hostname resolves to.
+func (g *George) hostKeyConfig(config *ssh.ClientConfig, server *forge.Server) error {
+	var known ssh.HostKeyCallback
+	if files := g.knownHostsFiles(); len(files) > 0 {
+		var err error
+		known, err = knownhosts.New(files...)
+		if err != nil {
+			return err
+		}
+		config.HostKeyAlgorithms = knownKeyTypes(known, server)
+	}
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if tcpAddr, ok := remote.(*net.TCPAddr); ok && !tcpAddr.IP.Equal(net.ParseIP(server.IPAddress)) {
+			return fmt.Errorf("Connected to %s, but Forge says %s is at %s.",
+				tcpAddr.IP, server.Name, server.IPAddress)
+		}
+		if known != nil {
+			err := known(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			if err == nil {
+				return nil
+			} else if !errors.As(err, &keyErr) {
+				return err
+			} else if len(keyErr.Want) > 0 {
+				return hostKeyMismatchError(g.KnownHostsPath(), server, key, keyErr.Want)
+			}
+		}
+		if g.strictHostKeys {
+			return fmt.Errorf("Host key of %s (%s) is unknown, and --strict-host-keys is set.",
+				server.Name, server.IPAddress)
+		}
+		return g.addHostKey(hostname, server, key)
+	}
+	return nil
+}
+
+// knownKeyTypes returns the types of the host keys known for the given
+// server, so that the server is asked for a key we can verify rather than
+// a key of another type that would look like a mismatch.
+func knownKeyTypes(known ssh.HostKeyCallback, server *forge.Server) []string {
+	addr := &net.TCPAddr{IP: net.ParseIP(server.IPAddress), Port: 22}
+	// Verifying a key that can't be known reveals the keys that are.
+	unknownKey, err := ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+	if err != nil {
+		return nil
+	}
+	var keyErr *knownhosts.KeyError
+	if !errors.As(known(addr.String(), addr, unknownKey), &keyErr) {
+		return nil
+	}
+	var types []string
+	for _, k := range keyErr.Want {
+		types = append(types, k.Key.Type())
+	}
+	return types
+}
+
+func hostKeyMismatchError(knownHostsPath string, server *forge.Server, key ssh.PublicKey, want []knownhosts.KnownKey) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "HOST KEY OF %s (%s) HAS CHANGED!\n", server.Name, server.IPAddress)
+	fmt.Fprintf(&b, "Someone could be eavesdropping on you right now, or the server was rebuilt.\n")
+	fmt.Fprintf(&b, "The server sent %s %s, but expected:\n", key.Type(), ssh.FingerprintSHA256(key))
+	for _, k := range want {
+		fmt.Fprintf(&b, "  %s %s (%s:%d)\n", k.Key.Type(), ssh.FingerprintSHA256(k.Key), k.Filename, k.Line)
+	}
+	// Keys in OpenSSH's known_hosts aren't ours to remove.
+	fmt.Fprintf(&b, "If the server was rebuilt, run:")
+	if want[0].Filename == knownHostsPath {
+		fmt.Fprintf(&b, " george hostkeys reset %s", server.Name)
+	} else {
+		fmt.Fprintf(&b, " ssh-keygen -R %s -f %s", server.IPAddress, want[0].Filename)
+	}
+	return errors.New(b.String())
+}
+
+func (g *George) addHostKey(hostname string, server *forge.Server, key ssh.PublicKey) error {
+	f, err := os.OpenFile(g.KnownHostsPath(), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	line := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key)
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Added %s key %s of %s (%s) to %s.\n",
+		key.Type(), ssh.FingerprintSHA256(key), server.Name, server.IPAddress, g.KnownHostsPath())
+	return nil
+}
+
+// ResetHostKeys forgets the host keys george added for the given server,
+// so the next connection trusts whatever key it presents. It returns the
+// number of keys removed.
+func (g *George) ResetHostKeys(server *forge.Server) (int, error) {
+	data, err := ioutil.ReadFile(g.KnownHostsPath())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	host := knownhosts.Normalize(server.IPAddress + ":22")
+	var kept bytes.Buffer
+	removed := 0
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if fields := strings.Fields(line); len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+			match := false
+			for _, h := range strings.Split(fields[0], ",") {
+				if h == host {
+					match = true
+				}
+			}
+			if match {
+				removed++
+				continue
+			}
+		}
+		kept.WriteString(line)
+		kept.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, ioutil.WriteFile(g.KnownHostsPath(), kept.Bytes(), 0600)
+}
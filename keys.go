@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/zippoxer/george/forge"
+)
+
+// serverKey is an SSH key registered with a server.
+type serverKey struct {
+	Server forge.Server
+	Key    forge.Key
+}
+
+// GeorgeKeys returns the SSH keys george registered across all servers,
+// sorted by server and key name.
+func (g *George) GeorgeKeys(ctx context.Context) ([]serverKey, error) {
+	servers, err := g.cache.Servers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		result   []serverKey
+		firstErr error
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+	)
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server forge.Server) {
+			defer wg.Done()
+			keys, err := g.client.Keys(server.Id).ListContext(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%s: %v", server.Name, err)
+				}
+				return
+			}
+			for _, key := range keys {
+				if strings.HasPrefix(key.Name, "george-") {
+					result = append(result, serverKey{Server: server, Key: key})
+				}
+			}
+		}(server)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Server.Name != result[j].Server.Name {
+			return result[i].Server.Name < result[j].Server.Name
+		}
+		return result[i].Key.Name < result[j].Key.Name
+	})
+	return result, nil
+}
+
+// PrintKeys prints the SSH keys george registered across all servers,
+// marking the one of the current user.
+func (g *George) PrintKeys(ctx context.Context, w io.Writer) error {
+	publicKey, err := g.sshPublicKey()
+	if err != nil {
+		return err
+	}
+	myNames := g.sshKeyNames(publicKey)
+	keys, err := g.GeorgeKeys(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERVER\tIP\tKEY ID\tOWNER\tSTATUS\t")
+	for _, k := range keys {
+		owner := strings.TrimPrefix(k.Key.Name, "george-")
+		if hasName(myNames, k.Key.Name) {
+			owner += " (you)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\t\n",
+			k.Server.Name, k.Server.IPAddress, k.Key.Id, owner, k.Key.Status)
+	}
+	return tw.Flush()
+}
+
+// RotateKey registers the public key at newPublicKeyPath with every server
+// that has the current key registered, and only once all of them succeeded,
+// saves its private key as the identity to use from now on and removes the
+// current key from them.
+func (g *George) RotateKey(ctx context.Context, newPublicKeyPath string) error {
+	newPublicKey, err := readPublicKey(newPublicKeyPath)
+	if err != nil {
+		return err
+	}
+	identity, err := filepath.Abs(strings.TrimSuffix(newPublicKeyPath, ".pub"))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(identity); !strings.HasSuffix(newPublicKeyPath, ".pub") || err != nil {
+		return fmt.Errorf("Can't find the private key of %s. It should be next to it, without the .pub extension, so that george can use it from now on.",
+			newPublicKeyPath)
+	}
+	oldPublicKey, err := g.sshPublicKey()
+	if err != nil {
+		return err
+	}
+	oldNames, newNames := g.sshKeyNames(oldPublicKey), g.sshKeyNames(newPublicKey)
+	if oldNames[0] == newNames[0] {
+		return errors.New("The new key is the key you're already using.")
+	}
+	keys, err := g.GeorgeKeys(ctx)
+	if err != nil {
+		return err
+	}
+	var old []serverKey
+	for _, k := range keys {
+		if hasName(oldNames, k.Key.Name) {
+			old = append(old, k)
+		}
+	}
+	if len(old) == 0 {
+		return errors.New("Your current key isn't registered with any server.")
+	}
+
+	err = g.forEachKey(old, func(k serverKey) error {
+		err := g.installKey(ctx, k.Server.Id, newPublicKey)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "Registered new key with %s.\n", k.Server.Name)
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%v\nThe old key was left registered with all servers.", err)
+	}
+	g.config.Identity = identity
+	if err := g.config.save(); err != nil {
+		return fmt.Errorf("Saving the new identity: %v\nThe old key was left registered with all servers.", err)
+	}
+	return g.deleteKeys(ctx, old)
+}
+
+// PruneKeys removes every SSH key george registered, except for the given
+// public keys, after confirming unless yes is true.
+func (g *George) PruneKeys(ctx context.Context, except [][]byte, yes bool) error {
+	keep := make(map[string]bool)
+	for _, publicKey := range except {
+		for _, name := range g.sshKeyNames(publicKey) {
+			keep[name] = true
+		}
+	}
+	keys, err := g.GeorgeKeys(ctx)
+	if err != nil {
+		return err
+	}
+	var prune []serverKey
+	for _, k := range keys {
+		if !keep[k.Key.Name] {
+			prune = append(prune, k)
+		}
+	}
+	if len(prune) == 0 {
+		fmt.Fprintln(os.Stderr, "No keys to remove.")
+		return nil
+	}
+	for _, k := range prune {
+		fmt.Printf("  %s (%s): %s\n", k.Server.Name, k.Server.IPAddress, k.Key.Name)
+	}
+	if !yes && !confirm(fmt.Sprintf("Remove these %d keys?", len(prune))) {
+		return errors.New("Aborted.")
+	}
+	return g.deleteKeys(ctx, prune)
+}
+
+func (g *George) deleteKeys(ctx context.Context, keys []serverKey) error {
+	return g.forEachKey(keys, func(k serverKey) error {
+		err := g.client.Keys(k.Server.Id).DeleteContext(ctx, k.Key.Id)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "Removed %s from %s.\n", k.Key.Name, k.Server.Name)
+		}
+		return err
+	})
+}
+
+// forEachKey calls fn concurrently for each key, returning an error that
+// lists every failure.
+func (g *George) forEachKey(keys []serverKey, fn func(k serverKey) error) error {
+	var (
+		errs []string
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+	)
+	for _, k := range keys {
+		wg.Add(1)
+		go func(k serverKey) {
+			defer wg.Done()
+			if err := fn(k); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Sprintf("%s: %v", k.Server.Name, err))
+				mu.Unlock()
+			}
+		}(k)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
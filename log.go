@@ -0,0 +1,524 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/zippoxer/george/forge"
+)
+
+// logLevels are Monolog's levels, from the least to the most severe.
+var logLevels = []string{"debug", "info", "notice", "warning", "error", "critical", "alert", "emergency"}
+
+// logSeverity returns the severity of a log level, or -1 if it's unknown.
+func logSeverity(level string) int {
+	level = strings.ToLower(level)
+	for i, l := range logLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// logTimeLayout is the layout of the time at the start of log entries.
+const logTimeLayout = "2006-01-02 15:04:05"
+
+// logHeaderRegexp matches the first line of a log entry, such as
+// "[2019-03-26 21:52:13] production.ERROR: Something broke".
+var logHeaderRegexp = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})[^\]]*\] (.+?)\.([A-Za-z]+): ?(.*)`)
+
+// logHeader is what the first line of a log entry tells about it.
+type logHeader struct {
+	Time    time.Time
+	Env     string
+	Level   string
+	Message string
+}
+
+// parseLogHeader parses line if it's the first line of a log entry. Times
+// are taken to be UTC, Laravel's default timezone.
+func parseLogHeader(line string) (logHeader, bool) {
+	m := logHeaderRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return logHeader{}, false
+	}
+	t, err := time.Parse(logTimeLayout, m[1])
+	if err != nil {
+		return logHeader{}, false
+	}
+	return logHeader{
+		Time:    t,
+		Env:     m[2],
+		Level:   strings.ToLower(m[3]),
+		Message: strings.TrimRight(m[4], "\r"),
+	}, true
+}
+
+// parseLogTime parses a time given to --since or --until: either a
+// duration ago, such as 2h, or a UTC date or time, such as 2019-03-26 or
+// "2019-03-26 21:52".
+func parseLogTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, logTimeLayout, "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid time %q. Use a duration such as 2h, or a time such as \"2019-03-26 21:52\".", s)
+}
+
+// logOptions choose which part of a site's log to print.
+type logOptions struct {
+	// Follow keeps printing entries as they're written.
+	Follow bool
+
+	// Lines starts from the last given number of lines, or the whole
+	// log if zero.
+	Lines int
+
+	// Since and Until, unless zero, leave out entries before or after
+	// them.
+	Since, Until time.Time
+
+	// Level leaves out entries less severe than it, unless empty.
+	Level string
+
+	// Output is text to print entries as they are, or json to print them
+	// parsed, one JSON object per line.
+	Output string
+
+	// Group prints how many times each exception or message was logged,
+	// rather than the entries.
+	Group bool
+}
+
+// logIdle is how long a followed log may be quiet before its last entry
+// is taken to be complete.
+const logIdle = 500 * time.Millisecond
+
+// logFilter passes through the entries of a log matching the options,
+// deciding by the first line of each entry.
+type logFilter struct {
+	opts     logOptions
+	severity int
+}
+
+func newLogFilter(opts logOptions) (*logFilter, error) {
+	f := &logFilter{opts: opts, severity: -1}
+	if opts.Level != "" {
+		f.severity = logSeverity(opts.Level)
+		if f.severity < 0 {
+			return nil, fmt.Errorf("Unknown log level %q. Levels are: %s.", opts.Level, strings.Join(logLevels, ", "))
+		}
+	}
+	return f, nil
+}
+
+func (f *logFilter) empty() bool {
+	return f.severity < 0 && f.opts.Since.IsZero() && f.opts.Until.IsZero()
+}
+
+func (f *logFilter) matchEntry(e *logEntry) bool {
+	return f.match(logHeader{Time: e.Time, Env: e.Env, Level: e.Level})
+}
+
+func (f *logFilter) match(h logHeader) bool {
+	if f.severity >= 0 && logSeverity(h.Level) < f.severity {
+		return false
+	}
+	if !f.opts.Since.IsZero() && h.Time.Before(f.opts.Since) {
+		return false
+	}
+	if !f.opts.Until.IsZero() && h.Time.After(f.opts.Until) {
+		return false
+	}
+	return true
+}
+
+// Copy copies the matching entries of r to w. Lines before the first entry,
+// such as the end of an entry cut by --lines, are kept only if there's
+// nothing to filter by.
+func (f *logFilter) Copy(w io.Writer, r io.Reader) error {
+	br := bufio.NewReader(r)
+	keep := f.empty()
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			if h, ok := parseLogHeader(line); ok {
+				keep = f.match(h)
+			}
+			if keep {
+				if _, err := io.WriteString(w, line); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// logCommand returns a shell command printing the newest of the site's
+// Laravel logs, which is laravel.log or a laravel-YYYY-MM-DD.log of the
+// daily channel. Unless following, the output is compressed with gzip.
+func logCommand(site *forge.Site, opts logOptions) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cd %s/storage/logs && ", shellQuote(site.Name))
+	b.WriteString(`f=$(ls -t laravel*.log 2>/dev/null | head -n 1) && [ -n "$f" ] || { echo "No Laravel logs found." >&2; exit 1; }; `)
+	switch {
+	case opts.Follow:
+		lines := opts.Lines
+		if lines == 0 {
+			lines = 10
+		}
+		fmt.Fprintf(&b, `exec tail -n %d -F "$f"`, lines)
+	case opts.Lines > 0:
+		fmt.Fprintf(&b, `tail -n %d "$f" | gzip`, opts.Lines)
+	default:
+		b.WriteString(`gzip -c "$f"`)
+	}
+	return b.String()
+}
+
+// logStream is the output of logCommand running on a server.
+type logStream struct {
+	io.Reader
+	session *ssh.Session
+	done    chan struct{}
+}
+
+// startLog starts printing the site's log over client. The log stops when
+// ctx is done or the stream is closed.
+func startLog(ctx context.Context, client *ssh.Client, site *forge.Site, opts logOptions, stderr io.Writer) (*logStream, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	session.Stderr = stderr
+	pr, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.Start(logCommand(site, opts)); err != nil {
+		session.Close()
+		return nil, err
+	}
+	s := &logStream{Reader: pr, session: session, done: make(chan struct{})}
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-s.done:
+		}
+	}()
+	if !opts.Follow {
+		gzr, err := gzip.NewReader(pr)
+		if err != nil {
+			// The command failed before writing anything, so its error
+			// tells why.
+			if werr := session.Wait(); werr != nil {
+				err = werr
+			}
+			s.Close()
+			return nil, err
+		}
+		s.Reader = gzr
+	}
+	return s, nil
+}
+
+// Wait waits for the log command to exit.
+func (s *logStream) Wait() error {
+	return s.session.Wait()
+}
+
+func (s *logStream) Close() error {
+	close(s.done)
+	return s.session.Close()
+}
+
+// logDone returns what to make of err, which ended printing a log, once
+// ctx is done. Following ends with Ctrl-C, so that's no error.
+func logDone(ctx context.Context, opts logOptions, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	if opts.Follow && ctx.Err() == context.Canceled {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// Log prints the newest of the site's Laravel logs to w.
+func (g *George) Log(ctx context.Context, server *forge.Server, site *forge.Site, opts logOptions, w, stderr io.Writer) error {
+	filter, err := newLogFilter(opts)
+	if err != nil {
+		return err
+	}
+	if opts.Group && opts.Follow {
+		return fmt.Errorf("--group can't be used with --follow.")
+	}
+	client, err := g.SSHClient(ctx, server.Id)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	s, err := startLog(ctx, client, site, opts, stderr)
+	if err != nil {
+		return logDone(ctx, opts, err)
+	}
+	defer s.Close()
+
+	switch {
+	case opts.Group:
+		var groups []*logGroup
+		groups, err = groupLogEntries(s, filter)
+		if err == nil {
+			err = writeLogGroups(w, groups, opts.Output)
+		}
+	case opts.Output == "json":
+		var idle time.Duration
+		if opts.Follow {
+			idle = logIdle
+		}
+		err = writeLogEntriesJSON(w, s, filter, idle)
+	default:
+		err = filter.Copy(w, s)
+	}
+	if err == nil {
+		err = s.Wait()
+	}
+	return logDone(ctx, opts, err)
+}
+
+// LogSites prints the newest Laravel logs of several sites to w, merging
+// their entries chronologically and prefixing them with the site's name.
+// Sites on the same server share connections.
+func (g *George) LogSites(ctx context.Context, results []searchResult, opts logOptions, w, stderr io.Writer) error {
+	filter, err := newLogFilter(opts)
+	if err != nil {
+		return err
+	}
+	if opts.Group && opts.Follow {
+		return fmt.Errorf("--group can't be used with --follow.")
+	}
+	defer g.CloseSSHClients()
+
+	// Sites are named after their server too when another server has a
+	// site of the same name.
+	names := make([]string, len(results))
+	servers := make(map[string]map[int]bool)
+	for _, r := range results {
+		if servers[r.Site.Name] == nil {
+			servers[r.Site.Name] = make(map[int]bool)
+		}
+		servers[r.Site.Name][r.Server.Id] = true
+	}
+	width := 0
+	for i, r := range results {
+		names[i] = r.Site.Name
+		if len(servers[r.Site.Name]) > 1 {
+			names[i] = r.Server.Name + ":" + r.Site.Name
+		}
+		if len(names[i]) > width {
+			width = len(names[i])
+		}
+	}
+	prefixes := make(map[string]string)
+	for i := range results {
+		prefixes[names[i]] = colorize(prefixColors[i%len(prefixColors)],
+			fmt.Sprintf("%-*s", width, names[i])) + " | "
+	}
+
+	// Each site's entries are sent on its own channel, as merging
+	// chronologically requires the next entry of every site.
+	var stderrMu sync.Mutex
+	chans := make([]chan *logEntry, len(results))
+	errs := make([]error, len(results))
+	for i, r := range results {
+		chans[i] = make(chan *logEntry, 64)
+		go func(i int, r searchResult) {
+			defer close(chans[i])
+			errOut := &prefixWriter{w: stderr, mu: &stderrMu, prefix: prefixes[names[i]]}
+			err := g.siteLogEntries(ctx, r.Server, r.Site, names[i], opts, filter, errOut, chans[i])
+			errOut.Flush()
+			if err = logDone(ctx, opts, err); err != nil && ctx.Err() == nil {
+				errOut.Write([]byte(err.Error() + "\n"))
+			}
+			errs[i] = err
+		}(i, r)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	grouper := newLogGrouper()
+	print := func(e *logEntry) error {
+		switch {
+		case opts.Group:
+			grouper.add(e)
+		case opts.Output == "json":
+			return enc.Encode(e)
+		default:
+			for _, line := range e.lines {
+				if _, err := fmt.Fprintf(w, "%s%s\n", prefixes[e.Site], line); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if opts.Follow {
+		err = mergeFollowedLogEntries(chans, print)
+	} else {
+		err = mergeLogEntries(chans, print)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.Group {
+		if err := writeLogGroups(w, grouper.Groups(), opts.Output); err != nil {
+			return err
+		}
+	}
+
+	if err := logDone(ctx, opts, nil); err != nil {
+		return err
+	}
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("Failed reading the logs of %d of %d sites.", failed, len(results))
+	}
+	return nil
+}
+
+// siteLogEntries sends the site's matching log entries to c, with their
+// Site set to name.
+func (g *George) siteLogEntries(ctx context.Context, server *forge.Server, site *forge.Site, name string, opts logOptions, filter *logFilter, stderr io.Writer, c chan<- *logEntry) error {
+	client, release, err := g.pooledSSHClient(ctx, server.Id)
+	if err != nil {
+		return err
+	}
+	defer release()
+	s, err := startLog(ctx, client, site, opts, stderr)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	var idle time.Duration
+	if opts.Follow {
+		idle = logIdle
+	}
+	err = readLogEntries(s, idle, func(e *logEntry) error {
+		if !filter.matchEntry(e) {
+			return nil
+		}
+		e.Site = name
+		select {
+		case c <- e:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return s.Wait()
+}
+
+// mergeLogEntries calls print with the entries of all channels, oldest
+// first, assuming each channel's entries are in chronological order.
+func mergeLogEntries(chans []chan *logEntry, print func(*logEntry) error) error {
+	heads := make([]*logEntry, len(chans))
+	for i, c := range chans {
+		heads[i] = <-c
+	}
+	for {
+		next := -1
+		for i, e := range heads {
+			if e != nil && (next < 0 || e.Time.Before(heads[next].Time)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			return nil
+		}
+		if err := print(heads[next]); err != nil {
+			return err
+		}
+		heads[next] = <-chans[next]
+	}
+}
+
+// mergeFollowedLogEntries calls print with the entries of all channels as
+// they arrive, sorting those arriving close together chronologically.
+func mergeFollowedLogEntries(chans []chan *logEntry, print func(*logEntry) error) error {
+	merged := make(chan *logEntry)
+	var wg sync.WaitGroup
+	for _, c := range chans {
+		wg.Add(1)
+		go func(c chan *logEntry) {
+			defer wg.Done()
+			for e := range c {
+				merged <- e
+			}
+		}(c)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	ticker := time.NewTicker(logIdle)
+	defer ticker.Stop()
+	var buf []*logEntry
+	flush := func() error {
+		sort.SliceStable(buf, func(i, j int) bool {
+			return buf[i].Time.Before(buf[j].Time)
+		})
+		for _, e := range buf {
+			if err := print(e); err != nil {
+				return err
+			}
+		}
+		buf = buf[:0]
+		return nil
+	}
+	for {
+		select {
+		case e, ok := <-merged:
+			if !ok {
+				return flush()
+			}
+			buf = append(buf, e)
+		case <-ticker.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// logEntry is an entry of a Laravel log in Monolog's line format:
+// "[time] env.LEVEL: message context extra", where context and extra are
+// JSON, and an exception's stack trace spans the following lines.
+type logEntry struct {
+	Site      string        `json:"site,omitempty"`
+	Time      time.Time     `json:"time"`
+	Env       string        `json:"env"`
+	Level     string        `json:"level"`
+	Message   string        `json:"message"`
+	Context   interface{}   `json:"context,omitempty"`
+	Extra     interface{}   `json:"extra,omitempty"`
+	Exception *logException `json:"exception,omitempty"`
+
+	// lines are the lines of the entry as they were logged.
+	lines []string
+}
+
+// logException is the exception Laravel logs in the context of an entry.
+type logException struct {
+	Class   string   `json:"class"`
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	File    string   `json:"file"`
+	Trace   []string `json:"trace,omitempty"`
+}
+
+// logExceptionRegexp matches Monolog's normalized exceptions, such as
+// "[object] (RuntimeException(code: 0): Oops at /path/File.php:12)".
+var logExceptionRegexp = regexp.MustCompile(`(?s)^\[object\] \((.+?)\(code: (.*?)\): (.*) at (.+?:\d+)\)\s*$`)
+
+// parseLogEntry parses the lines of an entry, the first of which is its
+// header.
+func parseLogEntry(h logHeader, lines []string) *logEntry {
+	e := &logEntry{Time: h.Time, Env: h.Env, Level: h.Level}
+	body := strings.TrimRight(strings.Join(append([]string{h.Message}, lines...), "\n"), "\n")
+	e.Message = body
+
+	// The message is followed by the context and extra as JSON, unless
+	// they're empty and left out. Monolog leaves line breaks in them
+	// unescaped, which is undone before decoding.
+	for i := 0; i < len(body)-1; i++ {
+		if body[i] != ' ' || body[i+1] != '{' && body[i+1] != '[' {
+			continue
+		}
+		values, ok := decodeJSONValues(escapeLineBreaks(body[i+1:]))
+		if !ok || len(values) > 2 {
+			continue
+		}
+		e.Message = body[:i]
+		e.Context = values[0]
+		if len(values) == 2 {
+			e.Extra = values[1]
+		}
+		break
+	}
+
+	if context, ok := e.Context.(map[string]interface{}); ok {
+		if s, ok := context["exception"].(string); ok {
+			if ex := parseLogException(s); ex != nil {
+				e.Exception = ex
+				delete(context, "exception")
+			}
+		}
+	}
+	e.Context = nonEmpty(e.Context)
+	e.Extra = nonEmpty(e.Extra)
+	return e
+}
+
+func parseLogException(s string) *logException {
+	var trace string
+	if i := strings.Index(s, "\n[stacktrace]\n"); i >= 0 {
+		s, trace = s[:i], s[i+len("\n[stacktrace]\n"):]
+	}
+	m := logExceptionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return nil
+	}
+	ex := &logException{Class: m[1], Code: m[2], Message: m[3], File: m[4]}
+	for _, line := range strings.Split(trace, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[previous exception]") {
+			break
+		}
+		ex.Trace = append(ex.Trace, line)
+	}
+	return ex
+}
+
+func escapeLineBreaks(s string) string {
+	return strings.NewReplacer("\r", `\r`, "\n", `\n`).Replace(s)
+}
+
+// decodeJSONValues decodes s as a series of space separated JSON values.
+func decodeJSONValues(s string) ([]interface{}, bool) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	var values []interface{}
+	for {
+		var v interface{}
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			return values, len(values) > 0
+		}
+		if err != nil {
+			return nil, false
+		}
+		values = append(values, v)
+	}
+}
+
+// nonEmpty returns v, or nil if it's an empty JSON object or array.
+func nonEmpty(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+	}
+	return v
+}
+
+// readLogEntries reads the entries of a log from r, calling emit with each.
+// Lines before the first entry are skipped. An entry is complete once the
+// next begins, or, if idle isn't zero, once no more lines are written for
+// that long, so that followed entries aren't held back.
+func readLogEntries(r io.Reader, idle time.Duration, emit func(*logEntry) error) error {
+	type line struct {
+		s   string
+		err error
+	}
+	lines := make(chan line)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		br := bufio.NewReader(r)
+		for {
+			s, err := br.ReadString('\n')
+			select {
+			case lines <- line{s, err}:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var header *logHeader
+	var headerLine string
+	var rest []string
+	flush := func() error {
+		if header == nil {
+			return nil
+		}
+		e := parseLogEntry(*header, rest)
+		e.lines = append([]string{headerLine}, rest...)
+		header, rest = nil, nil
+		return emit(e)
+	}
+	var timeout <-chan time.Time
+	for {
+		if header != nil && idle > 0 {
+			timeout = time.After(idle)
+		} else {
+			timeout = nil
+		}
+		select {
+		case l := <-lines:
+			if l.s != "" {
+				s := strings.TrimRight(l.s, "\r\n")
+				if h, ok := parseLogHeader(s); ok {
+					if err := flush(); err != nil {
+						return err
+					}
+					header, headerLine = &h, s
+				} else if header != nil {
+					rest = append(rest, s)
+				}
+			}
+			if l.err == io.EOF {
+				return flush()
+			}
+			if l.err != nil {
+				return l.err
+			}
+		case <-timeout:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// writeLogEntriesJSON writes the matching entries of r to w as JSON, one
+// object per line.
+func writeLogEntriesJSON(w io.Writer, r io.Reader, filter *logFilter, idle time.Duration) error {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return readLogEntries(r, idle, func(e *logEntry) error {
+		if !filter.matchEntry(e) {
+			return nil
+		}
+		return enc.Encode(e)
+	})
+}
+
+// logGroup is a set of entries logging the same exception, or the same
+// message if there's no exception.
+type logGroup struct {
+	Count     int           `json:"count"`
+	Level     string        `json:"level"`
+	Message   string        `json:"message"`
+	Exception *logException `json:"exception,omitempty"`
+	FirstSeen time.Time     `json:"first_seen"`
+	LastSeen  time.Time     `json:"last_seen"`
+}
+
+// groupKey identifies the group of an entry. Exceptions are identical if
+// they're of the same class and thrown from the same place, as their
+// messages often differ in details such as ids.
+func (e *logEntry) groupKey() string {
+	if e.Exception != nil {
+		return "exception\x00" + e.Exception.Class + "\x00" + e.Exception.File
+	}
+	return "message\x00" + e.Level + "\x00" + e.Message
+}
+
+// logGrouper groups log entries.
+type logGrouper struct {
+	groups map[string]*logGroup
+	order  []*logGroup
+}
+
+func newLogGrouper() *logGrouper {
+	return &logGrouper{groups: make(map[string]*logGroup)}
+}
+
+// add adds an entry to its group. Entries are expected in chronological
+// order.
+func (gr *logGrouper) add(e *logEntry) {
+	key := e.groupKey()
+	g, ok := gr.groups[key]
+	if !ok {
+		g = &logGroup{Level: e.Level, Message: e.Message, FirstSeen: e.Time}
+		gr.groups[key] = g
+		gr.order = append(gr.order, g)
+	}
+	g.Count++
+	if logSeverity(e.Level) > logSeverity(g.Level) {
+		g.Level = e.Level
+	}
+	// Keep the latest occurrence, which is the most relevant.
+	g.Message = e.Message
+	if e.Exception != nil {
+		ex := *e.Exception
+		ex.Trace = nil
+		g.Exception = &ex
+	}
+	g.LastSeen = e.Time
+}
+
+// Groups returns the groups from the largest to the smallest.
+func (gr *logGrouper) Groups() []*logGroup {
+	sort.SliceStable(gr.order, func(i, j int) bool {
+		if gr.order[i].Count != gr.order[j].Count {
+			return gr.order[i].Count > gr.order[j].Count
+		}
+		return gr.order[i].LastSeen.After(gr.order[j].LastSeen)
+	})
+	return gr.order
+}
+
+// groupLogEntries reads the matching entries of r, and returns their groups
+// from the largest to the smallest.
+func groupLogEntries(r io.Reader, filter *logFilter) ([]*logGroup, error) {
+	gr := newLogGrouper()
+	err := readLogEntries(r, 0, func(e *logEntry) error {
+		if filter.matchEntry(e) {
+			gr.add(e)
+		}
+		return nil
+	})
+	return gr.Groups(), err
+}
+
+// writeLogGroups writes groups as a table, or as JSON objects one per line
+// if output is json.
+func writeLogGroups(w io.Writer, groups []*logGroup, output string) error {
+	if output == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		for _, g := range groups {
+			if err := enc.Encode(g); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COUNT\tLEVEL\tLAST SEEN\tMESSAGE")
+	for _, g := range groups {
+		message := g.Message
+		if g.Exception != nil {
+			message = fmt.Sprintf("%s: %s (%s)", g.Exception.Class, firstLine(g.Exception.Message, 80), g.Exception.File)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", g.Count, g.Level,
+			g.LastSeen.Format(logTimeLayout), firstLine(message, 200))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parseTestLogEntry parses an entry from the lines of a log file.
+func parseTestLogEntry(t *testing.T, text string) *logEntry {
+	lines := strings.Split(text, "\n")
+	h, ok := parseLogHeader(lines[0])
+	if !ok {
+		t.Fatalf("%q isn't a log header", lines[0])
+	}
+	return parseLogEntry(h, lines[1:])
+}
+
+func TestParseLogEntry(t *testing.T) {
+	e := parseTestLogEntry(t, `[2019-03-26 21:52:01] production.INFO: User logged in {"id":42} {"ip":"10.0.0.1"}`)
+	if got := e.Time.Format(logTimeLayout); got != "2019-03-26 21:52:01" {
+		t.Errorf("got time %s", got)
+	}
+	if e.Env != "production" || e.Level != "info" || e.Message != "User logged in" {
+		t.Errorf("got env %q, level %q, message %q", e.Env, e.Level, e.Message)
+	}
+	if want := map[string]interface{}{"id": 42.0}; !reflect.DeepEqual(e.Context, want) {
+		t.Errorf("got context %v, want %v", e.Context, want)
+	}
+	if want := map[string]interface{}{"ip": "10.0.0.1"}; !reflect.DeepEqual(e.Extra, want) {
+		t.Errorf("got extra %v, want %v", e.Extra, want)
+	}
+}
+
+func TestParseLogEntryWithoutContext(t *testing.T) {
+	tests := []struct {
+		text    string
+		message string
+	}{
+		{`[2019-03-26 21:52:01] local.DEBUG: Cache cleared [] []`, "Cache cleared"},
+		{`[2019-03-26 21:52:01] local.DEBUG: Cache cleared`, "Cache cleared"},
+		{`[2019-03-26 21:52:01] local.DEBUG: Not JSON {nope}`, "Not JSON {nope}"},
+		{"[2019-03-26 21:52:01] local.DEBUG: Line 1\nLine 2\n", "Line 1\nLine 2"},
+	}
+	for _, test := range tests {
+		e := parseTestLogEntry(t, test.text)
+		if e.Message != test.message || e.Context != nil || e.Extra != nil {
+			t.Errorf("%q: got message %q, context %v, extra %v, want message %q",
+				test.text, e.Message, e.Context, e.Extra, test.message)
+		}
+	}
+}
+
+func TestParseLogEntryWithException(t *testing.T) {
+	e := parseTestLogEntry(t, `[2019-03-26 21:52:01] production.ERROR: Oops {"userId":1,"exception":"[object] (RuntimeException(code: 0): Oops at /home/forge/app/Http/Kernel.php:12)
+[stacktrace]
+#0 /home/forge/app/index.php(55): handle()
+#1 {main}
+"} []`)
+	if e.Message != "Oops" {
+		t.Errorf("got message %q", e.Message)
+	}
+	want := &logException{
+		Class:   "RuntimeException",
+		Code:    "0",
+		Message: "Oops",
+		File:    "/home/forge/app/Http/Kernel.php:12",
+		Trace:   []string{"#0 /home/forge/app/index.php(55): handle()", "#1 {main}"},
+	}
+	if !reflect.DeepEqual(e.Exception, want) {
+		t.Errorf("got exception %+v, want %+v", e.Exception, want)
+	}
+	if want := map[string]interface{}{"userId": 1.0}; !reflect.DeepEqual(e.Context, want) {
+		t.Errorf("got context %v, want %v", e.Context, want)
+	}
+	if e.Extra != nil {
+		t.Errorf("got extra %v, want none", e.Extra)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/zippoxer/george/forge"
+)
+
+// lsColumn is a column george ls can print. Site is nil for servers
+// without sites.
+type lsColumn struct {
+	name  string
+	value func(server *forge.Server, site *forge.Site) string
+}
+
+var lsColumns = []lsColumn{
+	{"server", func(server *forge.Server, site *forge.Site) string { return server.Name }},
+	{"ip", func(server *forge.Server, site *forge.Site) string { return server.IPAddress }},
+	{"private-ip", func(server *forge.Server, site *forge.Site) string { return server.PrivateIPAddress }},
+	{"region", func(server *forge.Server, site *forge.Site) string { return server.Region }},
+	{"php", func(server *forge.Server, site *forge.Site) string { return server.PhpVersion }},
+	{"site", func(server *forge.Server, site *forge.Site) string {
+		if site == nil {
+			return ""
+		}
+		return site.Name
+	}},
+	{"repository", func(server *forge.Server, site *forge.Site) string {
+		if site == nil {
+			return ""
+		}
+		return site.Repository
+	}},
+	{"branch", func(server *forge.Server, site *forge.Site) string {
+		if site == nil {
+			return ""
+		}
+		return site.RepositoryBranch
+	}},
+	{"project-type", func(server *forge.Server, site *forge.Site) string {
+		if site == nil {
+			return ""
+		}
+		return site.ProjectType
+	}},
+	{"status", func(server *forge.Server, site *forge.Site) string {
+		if site == nil {
+			if server.IsReady {
+				return "ready"
+			}
+			return "provisioning"
+		}
+		return site.Status
+	}},
+}
+
+// lsDefaultColumns are printed unless other columns are asked for.
+const lsDefaultColumns = "server,ip,region,php,site,repository,branch"
+
+// lsColumnNames returns the names of all columns, for help texts.
+func lsColumnNames() string {
+	var names []string
+	for _, c := range lsColumns {
+		names = append(names, c.name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func parseLsColumns(spec string) ([]lsColumn, error) {
+	var columns []lsColumn
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, c := range lsColumns {
+			if c.name == name {
+				columns = append(columns, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("Unknown column %q. Columns are: %s.", name, lsColumnNames())
+		}
+	}
+	return columns, nil
+}
+
+// lsRow is a row of george ls, keeping the order of its columns when
+// encoded as JSON or YAML.
+type lsRow struct {
+	columns []lsColumn
+	values  []string
+}
+
+func (r lsRow) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, c := range r.columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(c.name)
+		value, _ := json.Marshal(r.values[i])
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func (r lsRow) MarshalYAML() (interface{}, error) {
+	m := make(yaml.MapSlice, len(r.columns))
+	for i, c := range r.columns {
+		m[i] = yaml.MapItem{Key: c.name, Value: r.values[i]}
+	}
+	return m, nil
+}
+
+// lsRows returns a row for each site, and for each server without sites.
+func lsRows(serverSites []ServerSites, columns []lsColumn) []lsRow {
+	var rows []lsRow
+	add := func(server *forge.Server, site *forge.Site) {
+		row := lsRow{columns: columns}
+		for _, c := range columns {
+			row.values = append(row.values, c.value(server, site))
+		}
+		rows = append(rows, row)
+	}
+	for i := range serverSites {
+		server := &serverSites[i]
+		if len(server.Sites) == 0 {
+			add(&server.Server, nil)
+		}
+		for j := range server.Sites {
+			add(&server.Server, &server.Sites[j])
+		}
+	}
+	return rows
+}
+
+// printInventory prints the given servers and sites in the given output
+// format: table, json, yaml or csv.
+func printInventory(w io.Writer, serverSites []ServerSites, columns []lsColumn, output string) error {
+	rows := lsRows(serverSites, columns)
+	switch output {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		var header []string
+		for _, c := range columns {
+			header = append(header, strings.ToUpper(c.name))
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row.values, "\t"))
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		var header []string
+		for _, c := range columns {
+			header = append(header, c.name)
+		}
+		cw.Write(header)
+		for _, row := range rows {
+			cw.Write(row.values)
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		if rows == nil {
+			rows = []lsRow{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(rows)
+	case "yaml":
+		b, err := yaml.Marshal(rows)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	return fmt.Errorf("Unknown output format %q.", output)
+}
+
+// printInventoryTemplate executes the given Go template for each server,
+// which has the fields of forge.Server and its Sites.
+func printInventoryTemplate(w io.Writer, serverSites []ServerSites, format string) error {
+	t, err := template.New("format").Parse(format)
+	if err != nil {
+		return err
+	}
+	for _, server := range serverSites {
+		if err := t.Execute(w, server); err != nil {
+			return err
+		}
+		if !strings.HasSuffix(format, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+	return nil
+}
@@ -1,9 +1,9 @@
 package main
 
 import (
-	"compress/gzip"
+	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"net/url"
@@ -12,9 +12,11 @@ import (
 	"os/signal"
 	"os/user"
 	"path/filepath"
+	"strings"
 	"text/template"
 	"time"
 
+	"github.com/joho/godotenv"
 	"github.com/phayes/freeport"
 	"github.com/skratchdot/open-golang/open"
 	"github.com/zippoxer/george/forge"
@@ -29,10 +31,45 @@ var (
 var (
 	app = kingpin.New("george", "A toolkit for Laravel Forge.")
 
+	appTimeout = app.Flag("timeout", "Give up after the given duration, such as 30s or 5m.").
+			Duration()
+	appStrictHostKeys = app.Flag("strict-host-keys",
+		"Refuse connecting to servers whose host key isn't known yet.").
+		Envar("GEORGE_STRICT_HOST_KEYS").
+		Bool()
+	appIdentity = app.Flag("identity",
+		"Private SSH key to use instead of ~/.ssh/id_rsa, id_ed25519 or id_ecdsa.").
+		Short('i').
+		Envar("GEORGE_IDENTITY").
+		String()
+	appNoInteractive = app.Flag("no-interactive",
+		"Fail instead of asking which server or site to use when several match.").
+		Envar("GEORGE_NO_INTERACTIVE").
+		Bool()
+
 	appLogin = app.Command("login",
 		"Login with API key provided at https://forge.laravel.com/user/profile#/api")
 	appLoginKey = appLogin.Arg("api-key", "").Required().String()
 
+	appLs        = app.Command("ls", "List servers and sites.")
+	appLsPattern = appLs.
+			Arg("pattern", "Only list servers and sites matching this server name, IP or site domain.").
+			HintAction(hintTargets(hintAll)).
+			String()
+	appLsColumns = appLs.
+			Flag("columns", "Comma-separated columns to print: "+lsColumnNames()+".").
+			Short('c').
+			Default(lsDefaultColumns).
+			String()
+	appLsOutput = appLs.
+			Flag("output", "Output format.").
+			Short('o').
+			Default("table").
+			Enum("table", "json", "yaml", "csv")
+	appLsFormat = appLs.
+			Flag("format", "Go template to print for each server, such as '{{.Name}}{{range .Sites}} {{.Name}}{{end}}'.").
+			String()
+
 	appSSH = app.Command("ssh",
 		"SSH to a server by name, IP or site domain. Wildcards are supported.")
 	appSSHTarget = appSSH.
@@ -41,6 +78,34 @@ var (
 			HintAction(hintTargets(hintAll)).
 			String()
 
+	appExec = app.Command("exec",
+		"Run a command on every server or site matching a pattern, such as: george exec 'web-*' -- df -h")
+	appExecTarget = appExec.
+			Arg("target", "Server name, IP, site domain or pattern.").
+			Required().
+			HintAction(hintTargets(hintAll)).
+			String()
+	appExecCommand = appExec.
+			Arg("command", "Command to run. Sites run it in their directory.").
+			Required().
+			Strings()
+	appExecConcurrency = appExec.
+				Flag("concurrency", "Maximum number of targets to run the command on at once.").
+				Short('c').
+				Default("10").
+				Int()
+
+	appArtisan = app.Command("artisan",
+		"Run artisan in a site's directory, such as: george artisan www.example.com -- migrate --force")
+	appArtisanSite = appArtisan.
+			Arg("site", "Site name.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+	appArtisanArgs = appArtisan.
+			Arg("args", "Arguments to artisan. Put them after -- if they start with a dash.").
+			Strings()
+
 	appTunnel = app.Command("tunnel",
 		"Opens an SSH tunnel that forwards a server's port a local port.")
 	appTunnelTarget = appTunnel.
@@ -56,20 +121,248 @@ var (
 			Arg("local-port", "").
 			Default("3307").
 			Uint16()
+	appTunnelForwards = appTunnel.
+				Flag("forward", "Forward local-port:[remote-host:]remote-port. Can be repeated.").
+				Short('L').
+				Strings()
+
+	appDBDump = app.Command("dbdump", "Dump a site's MySQL, MariaDB or PostgreSQL database.").
+			Alias("mysqldump")
+	appDBDumpSite = appDBDump.
+			Arg("site", "Site name.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+	appDBDumpTables = appDBDump.
+			Flag("tables", "Only dump the given tables, separated by commas. Can be repeated.").
+			Strings()
+	appDBDumpExcludeTables = appDBDump.
+				Flag("exclude-tables", "Leave out the given tables, separated by commas. Can be repeated.").
+				Strings()
+	appDBDumpNoData = appDBDump.Flag("no-data", "Only dump the schema.").Bool()
+	appDBDumpWhere  = appDBDump.
+			Flag("where", "Only dump rows matching a condition, such as \"created_at > '2019-01-01'\". MySQL only.").
+			String()
 
-	appMySQLDump     = app.Command("mysqldump", "mysqldump a website.")
-	appMySQLDumpSite = appMySQLDump.
+	appDBRestore = app.Command("dbrestore",
+		"Restore a site's database from a plain or gzip-compressed SQL dump, replacing its contents.")
+	appDBRestoreSite = appDBRestore.
 				Arg("site", "Site name.").
 				Required().
 				HintAction(hintTargets(hintSites)).
 				String()
+	appDBRestoreFile = appDBRestore.
+				Arg("file", "SQL dump to restore, optionally gzip-compressed. Defaults to stdin.").
+				Default("-").
+				String()
+	appDBRestoreYes = appDBRestore.
+			Flag("yes", "Restore without asking for confirmation.").
+			Short('y').
+			Bool()
+
+	appDB     = app.Command("db", "Manage site databases.")
+	appDBCopy = appDB.Command("copy",
+		"Replace a site's database with a copy of another site's database, such as to refresh staging from production.")
+	appDBCopyFrom = appDBCopy.
+			Arg("from", "Site to copy the database of.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+	appDBCopyTo = appDBCopy.
+			Arg("to", "Site whose database is replaced.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+	appDBCopyExcludeTables = appDBCopy.
+				Flag("exclude-tables", "Leave out the given tables, separated by commas. Can be repeated.").
+				Strings()
+	appDBCopyAfter = appDBCopy.
+			Flag("after", "Artisan command to run on the destination site after copying, such as 'db:anonymize'. Quoted like in a shell. Can be repeated.").
+			Strings()
+	appDBCopyYes = appDBCopy.
+			Flag("yes", "Copy without asking for confirmation.").
+			Short('y').
+			Bool()
 
 	appLog     = app.Command("log", "Print the latest Laravel application log.")
 	appLogSite = appLog.
+			Arg("site", "Site name, or a glob such as '*.example.com' to merge the logs of several sites.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+	appLogFollow = appLog.Flag("follow", "Keep printing entries as they're written.").Short('f').Bool()
+	appLogLines  = appLog.
+			Flag("lines", "Start from the last given number of lines. Defaults to 10 when following.").
+			Short('n').
+			Int()
+	appLogSince = appLog.
+			Flag("since", "Leave out entries before a UTC time such as \"2019-03-26 21:52\", or a duration ago such as 2h.").
+			String()
+	appLogUntil = appLog.
+			Flag("until", "Leave out entries after a UTC time, or a duration ago.").
+			String()
+	appLogLevel = appLog.
+			Flag("level", "Leave out entries less severe than the given level.").
+			Short('l').
+			Enum(logLevels...)
+	appLogOutput = appLog.
+			Flag("output", "Print entries as they are (text), or parsed as one JSON object per line (json).").
+			Short('o').
+			Default("text").
+			Enum("text", "json")
+	appLogGroup = appLog.
+			Flag("group", "Count how many times each exception or message was logged, most frequent first.").
+			Bool()
+
+	appDeploy     = app.Command("deploy", "Deploy a site and print the deployment's output.")
+	appDeploySite = appDeploy.
+			Arg("site", "Site name.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+
+	appDeployments = app.Command("deployments",
+		"List the latest deployment of every site.")
+	appDeploymentsPattern = appDeployments.
+				Arg("pattern", "Only list sites matching this server name, IP or site domain.").
+				HintAction(hintTargets(hintAll)).
+				String()
+	appDeploymentsWatch = appDeployments.
+				Flag("watch", "Keep refreshing the list.").
+				Short('w').
+				Bool()
+	appDeploymentsInterval = appDeployments.
+				Flag("interval", "How often to refresh the list with --watch.").
+				Default("30s").
+				Duration()
+
+	appDeployScript        = app.Command("deploy-script", "Manage a site's deploy script.")
+	appDeployScriptGet     = appDeployScript.Command("get", "Print a site's deploy script.")
+	appDeployScriptGetSite = appDeployScriptGet.
+				Arg("site", "Site name.").
+				Required().
+				HintAction(hintTargets(hintSites)).
+				String()
+	appDeployScriptEdit = appDeployScript.Command("edit",
+		"Edit a site's deploy script in $EDITOR and upload it.")
+	appDeployScriptEditSite = appDeployScriptEdit.
+				Arg("site", "Site name.").
+				Required().
+				HintAction(hintTargets(hintSites)).
+				String()
+	appDeployScriptSet = appDeployScript.Command("set",
+		"Upload a site's deploy script from a file, unless it's unchanged.")
+	appDeployScriptSetSite = appDeployScriptSet.
+				Arg("site", "Site name.").
+				Required().
+				HintAction(hintTargets(hintSites)).
+				String()
+	appDeployScriptSetFile = appDeployScriptSet.
+				Flag("from-file", "File to upload, or - for stdin.").
+				Required().
+				String()
+
+	appEnv        = app.Command("env", "Manage a site's .env file.")
+	appEnvGet     = appEnv.Command("get", "Print a site's .env file, or the value of a key.")
+	appEnvGetSite = appEnvGet.
+			Arg("site", "Site name.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+	appEnvGetKey  = appEnvGet.Arg("key", "Print only the value of this key.").String()
+	appEnvGetJSON = appEnvGet.Flag("json", "Print the variables as a JSON object.").Bool()
+	appEnvSet     = appEnv.Command("set", "Set variables in a site's .env file.")
+	appEnvSetSite = appEnvSet.
+			Arg("site", "Site name.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+	appEnvSetVars   = appEnvSet.Arg("vars", "KEY=VALUE pairs.").Required().Strings()
+	appEnvUnset     = appEnv.Command("unset", "Remove variables from a site's .env file.")
+	appEnvUnsetSite = appEnvUnset.
 			Arg("site", "Site name.").
 			Required().
 			HintAction(hintTargets(hintSites)).
 			String()
+	appEnvUnsetKeys = appEnvUnset.Arg("keys", "Keys to remove.").Required().Strings()
+	appEnvEdit      = appEnv.Command("edit", "Edit a site's .env file in $EDITOR and upload it.")
+	appEnvEditSite  = appEnvEdit.
+			Arg("site", "Site name.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+	appEnvPull     = appEnv.Command("pull", "Download a site's .env file.")
+	appEnvPullSite = appEnvPull.
+			Arg("site", "Site name.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+	appEnvPullFile = appEnvPull.Arg("file", "File to write, or - for stdout.").Required().String()
+	appEnvPush     = appEnv.Command("push", "Upload a local file as a site's .env file.")
+	appEnvPushSite = appEnvPush.
+			Arg("site", "Site name.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+	appEnvPushFile = appEnvPush.Arg("file", "File to upload, or - for stdin.").Required().String()
+	appEnvPushYes  = appEnvPush.Flag("yes", "Upload without asking for confirmation.").Short('y').Bool()
+
+	appEnvDiff      = appEnv.Command("diff", "Compare the .env files of two sites, or of a site and a local file.")
+	appEnvDiffSiteA = appEnvDiff.
+			Arg("site", "Site name.").
+			Required().
+			HintAction(hintTargets(hintSites)).
+			String()
+	appEnvDiffSiteB = appEnvDiff.
+			Arg("other-site", "Site name to compare with.").
+			HintAction(hintTargets(hintSites)).
+			String()
+	appEnvDiffFile   = appEnvDiff.Flag("file", "Local .env file to compare with.").Short('f').String()
+	appEnvDiffReveal = appEnvDiff.Flag("reveal", "Show the values of passwords, keys, secrets and tokens.").Bool()
+
+	appAlias        = app.Command("alias", "Manage short names for servers and sites.")
+	appAliasAdd     = appAlias.Command("add", "Add an alias, or change what it stands for.")
+	appAliasAddName = appAliasAdd.
+			Arg("name", "Alias name.").
+			Required().
+			String()
+	appAliasAddPattern = appAliasAdd.
+				Arg("pattern", "Server name, IP, site domain or server:site pattern the alias stands for.").
+				Required().
+				HintAction(hintTargets(hintAll)).
+				String()
+	appAliasRm     = appAlias.Command("rm", "Remove an alias.")
+	appAliasRmName = appAliasRm.
+			Arg("name", "Alias name.").
+			Required().
+			HintAction(hintAliases).
+			String()
+	appAliasLs = appAlias.Command("ls", "List aliases.")
+
+	appHostKeys      = app.Command("hostkeys", "Manage the SSH host keys george trusts.")
+	appHostKeysReset = appHostKeys.Command("reset",
+		"Forget a server's host key, such as after it was rebuilt.")
+	appHostKeysResetServer = appHostKeysReset.
+				Arg("server", "Server name or IP.").
+				Required().
+				HintAction(hintTargets(hintServers)).
+				String()
+
+	appKeys       = app.Command("keys", "Manage the SSH keys george registered with servers.")
+	appKeysList   = appKeys.Command("list", "List the SSH keys george registered across all servers.")
+	appKeysRotate = appKeys.Command("rotate",
+		"Register a new SSH key wherever your current key is, then remove the current key.")
+	appKeysRotateNew = appKeysRotate.
+				Arg("public-key", "Public key file of the new key.").
+				Required().
+				String()
+	appKeysPrune = appKeys.Command("prune",
+		"Remove every SSH key george registered, except for the given keys.")
+	appKeysPruneExcept = appKeysPrune.
+				Flag("except", "Public key file of a key to keep. Can be repeated.").
+				Required().
+				Strings()
+	appKeysPruneYes = appKeysPrune.Flag("yes", "Remove without asking for confirmation.").Short('y').Bool()
 
 	appSequelPro     = app.Command("sequelpro", "Open a site's database in Sequel Pro.")
 	appSequelProSite = appSequelPro.
@@ -89,21 +382,38 @@ var (
 func main() {
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	app.HelpFlag.Hidden()
-	cmd := kingpin.MustParse(app.Parse(os.Args[1:]))
+	cmd, err := app.Parse(os.Args[1:])
+	if cmd == appEnvDiff.FullCommand() || err != nil && parsedCommand(os.Args[1:]) == appEnvDiff.FullCommand() {
+		// Exit like diff(1), whose exit code 1 means the files differ.
+		errorExitCode = 2
+	}
+	if err != nil {
+		app.Errorf("%s, try --help", err)
+		os.Exit(errorExitCode)
+	}
 
 	key, err := loadAPIKey()
 	if os.IsNotExist(err) {
 		if cmd != "login" {
-			log.Fatal("You're not logged in. Login with 'george <api-key>'")
+			fatal("You're not logged in. Login with 'george <api-key>'")
 		}
 	} else if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
-	client := forge.New(key)
+	ctx, cancel := newContext(*appTimeout)
+	defer cancel()
+
+	client := newClient(key)
 	george, err := New(client, time.Minute)
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
+	}
+	george.strictHostKeys = *appStrictHostKeys
+	george.identity = george.expandHome(*appIdentity)
+	if george.identity == "" {
+		george.identity = george.config.Identity
 	}
+	george.interactive = !*appNoInteractive
 
 	switch cmd {
 	case appLogin.FullCommand():
@@ -111,43 +421,70 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
-	case appLog.FullCommand():
-		server, site, err := george.SearchSite(*appLogSite)
+	case appLs.FullCommand():
+		columns, err := parseLsColumns(*appLsColumns)
 		if err != nil {
 			log.Fatal(err)
 		}
-		session, err := george.SSH(server.Id)
+		serverSites, err := george.MatchServerSites(ctx, *appLsPattern)
 		if err != nil {
 			log.Fatal(err)
 		}
-		session.Stderr = os.Stderr
-		pr, err := session.StdoutPipe()
+		if *appLsFormat != "" {
+			err = printInventoryTemplate(os.Stdout, serverSites, *appLsFormat)
+		} else {
+			err = printInventory(os.Stdout, serverSites, columns, *appLsOutput)
+		}
 		if err != nil {
 			log.Fatal(err)
 		}
-		cmd := fmt.Sprintf("cat %q | gzip", site.Name+"/storage/logs/laravel.log")
-		if err := session.Start(cmd); err != nil {
-			log.Fatalf("%s: %v", cmd, err)
+	case appLog.FullCommand():
+		opts := logOptions{
+			Follow: *appLogFollow,
+			Lines:  *appLogLines,
+			Level:  *appLogLevel,
+			Output: *appLogOutput,
+			Group:  *appLogGroup,
+		}
+		now := time.Now().UTC()
+		if *appLogSince != "" {
+			if opts.Since, err = parseLogTime(*appLogSince, now); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *appLogUntil != "" {
+			if opts.Until, err = parseLogTime(*appLogUntil, now); err != nil {
+				log.Fatal(err)
+			}
 		}
-		gzr, err := gzip.NewReader(pr)
+		if george.IsGlob(*appLogSite) {
+			sites, err := george.SearchSites(ctx, *appLogSite)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = george.LogSites(ctx, sites, opts, os.Stdout, os.Stderr)
+			if err != nil {
+				log.Fatal(err)
+			}
+			break
+		}
+		server, site, err := george.SearchSite(ctx, *appLogSite)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if _, err := io.Copy(os.Stdout, gzr); err != nil {
+		err = george.Log(ctx, server, site, opts, os.Stdout, os.Stderr)
+		if err != nil {
 			log.Fatal(err)
 		}
-		if err := session.Wait(); err != nil {
-			log.Fatalf("%s: %v", cmd, err)
-		}
 	case appTunnel.FullCommand():
-		server, site, err := george.Search(*appTunnelTarget)
+		server, site, err := george.Search(ctx, *appTunnelTarget)
 		if err != nil {
 			log.Fatal(err)
 		}
 
 		if site != nil && *appTunnelRemote == 3306 {
 			go func() {
-				env, err := client.Env(server.Id, site.Id).Get()
+				env, err := client.Env(server.Id, site.Id).GetContext(ctx)
 				if err != nil {
 					fmt.Printf("failed fetching .env: %v\n", err)
 				}
@@ -163,119 +500,427 @@ func main() {
 			}()
 		}
 
-		err = george.SSHInstallKey(server.Id)
+		var forwards []forward
+		for _, spec := range *appTunnelForwards {
+			f, err := parseForward(spec, server.IPAddress)
+			if err != nil {
+				log.Fatal(err)
+			}
+			forwards = append(forwards, f)
+		}
+		if len(forwards) == 0 {
+			forwards = append(forwards, forward{
+				local:  fmt.Sprintf("127.0.0.1:%d", *appTunnelLocal),
+				remote: fmt.Sprintf("%s:%d", server.IPAddress, *appTunnelRemote),
+			})
+		}
+
+		t := newTunnel(george, server.Id)
+		if err := t.Listen(forwards); err != nil {
+			log.Fatal(err)
+		}
+		for _, f := range forwards {
+			fmt.Printf("tunneling %s to %s\n", f.remote, f.local)
+		}
+		if err := t.Serve(ctx); err != nil {
+			log.Fatal(err)
+		}
+	case appSSH.FullCommand():
+		server, site, err := george.Search(ctx, *appSSHTarget)
 		if err != nil {
 			log.Fatal(err)
 		}
-
-		fmt.Printf("tunneling %s:%d to 127.0.0.1:%d\n",
-			server.IPAddress, *appTunnelRemote, *appTunnelLocal)
-		cmd := exec.Command("ssh",
-			"-L",
-			fmt.Sprintf("%d:%s:%d", *appTunnelLocal, server.IPAddress, *appTunnelRemote),
-			"-N",
-			fmt.Sprintf("forge@%s", server.IPAddress))
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		c := make(chan os.Signal, 2)
-		signal.Notify(c, os.Interrupt, os.Kill)
-		go func() {
-			<-c
-			cmd.Process.Kill()
+		var command string
+		if site != nil {
+			command = fmt.Sprintf("cd %s; exec bash -l", shellQuote(site.Name))
+		}
+		code, err := george.SSHShell(ctx, server.Id, command)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(code)
+	case appArtisan.FullCommand():
+		server, site, err := george.SearchSite(ctx, *appArtisanSite)
+		if err != nil {
+			log.Fatal(err)
+		}
+		code, err := george.Artisan(ctx, server, site, *appArtisanArgs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(code)
+	case appExec.FullCommand():
+		if *appExecConcurrency < 1 {
+			log.Fatal("--concurrency must be at least 1.")
+		}
+		targets, err := george.ExecTargets(ctx, *appExecTarget)
+		if err != nil {
+			log.Fatal(err)
+		}
+		command := strings.Join(*appExecCommand, " ")
+		results := george.Exec(ctx, targets, command, *appExecConcurrency, os.Stdout, os.Stderr)
+		george.CloseSSHClients()
+		fmt.Fprintln(os.Stderr)
+		if printExecSummary(os.Stderr, results) > 0 {
 			os.Exit(1)
-		}()
-
-		err = cmd.Run()
+		}
+	case appDBDump.FullCommand():
+		server, site, err := george.SearchSite(ctx, *appDBDumpSite)
 		if err != nil {
 			log.Fatal(err)
 		}
-	case appSSH.FullCommand():
-		server, site, err := george.Search(*appSSHTarget)
+		db, err := george.SiteDatabase(ctx, server, site)
 		if err != nil {
 			log.Fatal(err)
 		}
-		err = george.SSHInstallKey(server.Id)
+		opts := dumpOptions{
+			Tables:        splitList(*appDBDumpTables),
+			ExcludeTables: splitList(*appDBDumpExcludeTables),
+			NoData:        *appDBDumpNoData,
+			Where:         *appDBDumpWhere,
+		}
+		err = george.DumpDatabase(ctx, server, db, opts, os.Stdout, os.Stderr)
 		if err != nil {
 			log.Fatal(err)
 		}
-		var flags, args []string
-		args = append(args, "forge@"+server.IPAddress)
-		if site != nil {
-			flags = append(flags, "-t")
-			args = append(args, fmt.Sprintf("cd %q; bash -l", site.Name))
+	case appDBRestore.FullCommand():
+		server, site, err := george.SearchSite(ctx, *appDBRestoreSite)
+		if err != nil {
+			log.Fatal(err)
 		}
-		cmd := exec.Command("ssh", append(flags, args...)...)
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		err = cmd.Run()
+		db, err := george.SiteDatabase(ctx, server, site)
 		if err != nil {
 			log.Fatal(err)
 		}
-	case appMySQLDump.FullCommand():
-		server, site, err := george.SearchSite(*appMySQLDumpSite)
+		in := os.Stdin
+		if *appDBRestoreFile != "-" {
+			in, err = os.Open(*appDBRestoreFile)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer in.Close()
+		}
+		var size int64
+		if fi, err := in.Stat(); err == nil && fi.Mode().IsRegular() {
+			size = fi.Size()
+		}
+		if err := george.checkWritable(site); err != nil {
+			log.Fatal(err)
+		}
+		if !*appDBRestoreYes {
+			question := fmt.Sprintf("This replaces the contents of the %s database %s of %s, on %s.\nType the database name to continue:",
+				db.Driver, db.Name, site.Name, server.Name)
+			ok, err := confirmTyped(question, db.Name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !ok {
+				log.Fatal("Cancelled.")
+			}
+		}
+		progress := newProgressReader(in, size)
+		stop := progress.Start()
+		err = george.RestoreDatabase(ctx, server, db, progress, os.Stderr)
+		stop()
 		if err != nil {
 			log.Fatal(err)
 		}
-
-		// Parse .env file and extract MySQL connection settings.
-		env, err := client.Env(server.Id, site.Id).Get()
+		fmt.Fprintf(os.Stderr, "Restored %s of %s.\n", db.Name, site.Name)
+	case appDBCopy.FullCommand():
+		var after [][]string
+		for _, command := range *appDBCopyAfter {
+			args, err := splitShellWords(command)
+			if err != nil {
+				log.Fatal(err)
+			}
+			after = append(after, args)
+		}
+		var from, to siteDatabase
+		for _, s := range []struct {
+			pattern string
+			sdb     *siteDatabase
+		}{{*appDBCopyFrom, &from}, {*appDBCopyTo, &to}} {
+			server, site, err := george.SearchSite(ctx, s.pattern)
+			if err != nil {
+				log.Fatal(err)
+			}
+			db, err := george.SiteDatabase(ctx, server, site)
+			if err != nil {
+				log.Fatalf("%s: %v", site.Name, err)
+			}
+			*s.sdb = siteDatabase{Server: server, Site: site, DB: db}
+		}
+		if err := george.checkWritable(to.Site); err != nil {
+			log.Fatal(err)
+		}
+		if !*appDBCopyYes {
+			question := fmt.Sprintf("This replaces the contents of the %s database %s of %s, on %s, with the database %s of %s, on %s.\nType the name of the database to replace to continue:",
+				to.DB.Driver, to.DB.Name, to.Site.Name, to.Server.Name, from.DB.Name, from.Site.Name, from.Server.Name)
+			ok, err := confirmTyped(question, to.DB.Name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if !ok {
+				log.Fatal("Cancelled.")
+			}
+		}
+		err = george.CopyDatabase(ctx, &from, &to, splitList(*appDBCopyExcludeTables), os.Stderr)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if env.Get("DB_NAME") == "" {
-			// Not WordPress, try Laravel:
-			dbConn, _ := env["DB_CONNECTION"]
-			if dbConn == "" {
-				log.Fatal("No database found for this site.")
+		fmt.Fprintf(os.Stderr, "Copied %s of %s to %s of %s.\n", from.DB.Name, from.Site.Name, to.DB.Name, to.Site.Name)
+		for i, args := range after {
+			code, err := george.Artisan(ctx, to.Server, to.Site, args)
+			if err != nil {
+				log.Fatal(err)
 			}
-			if dbConn != "mysql" {
-				log.Fatalf("Unsupported database %s", dbConn)
+			if code != 0 {
+				log.Fatalf("artisan %s exited with status %d.", (*appDBCopyAfter)[i], code)
 			}
 		}
-		dbHost := env.Get("DB_HOST")
-		dbPort := env.Get("DB_PORT")
-		if dbPort == "" {
-			dbPort = "3306"
+	case appDeploy.FullCommand():
+		server, site, err := george.SearchSite(ctx, *appDeploySite)
+		if err != nil {
+			log.Fatal(err)
 		}
-		dbName := env.Get("DB_DATABASE", "DB_NAME")
-		dbUser := env.Get("DB_USERNAME", "DB_USER")
-		dbPwd := env.Get("DB_PASSWORD")
-
-		// Open an SSH session and execute mysqldump.
-		session, err := george.SSH(server.Id)
+		err = george.Deploy(ctx, server, site, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case appDeployments.FullCommand():
+		var interval time.Duration
+		if *appDeploymentsWatch {
+			interval = *appDeploymentsInterval
+		}
+		err = george.PrintDeployments(ctx, os.Stdout, *appDeploymentsPattern, interval)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case appDeployScriptGet.FullCommand():
+		server, site, err := george.SearchSite(ctx, *appDeployScriptGetSite)
+		if err != nil {
+			log.Fatal(err)
+		}
+		script, err := client.Deployments(server.Id, site.Id).ScriptContext(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(script)
+	case appDeployScriptEdit.FullCommand():
+		server, site, err := george.SearchSite(ctx, *appDeployScriptEditSite)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = george.EditDeployScript(ctx, server, site)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case appDeployScriptSet.FullCommand():
+		script, err := readFile(*appDeployScriptSetFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server, site, err := george.SearchSite(ctx, *appDeployScriptSetSite)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = george.SetDeployScript(ctx, server, site, string(script))
+		if err != nil {
+			log.Fatal(err)
+		}
+	case appEnvGet.FullCommand():
+		server, site, err := george.SearchSite(ctx, *appEnvGetSite)
+		if err != nil {
+			log.Fatal(err)
+		}
+		env := client.Env(server.Id, site.Id)
+		switch {
+		case *appEnvGetKey != "":
+			vars, err := env.GetContext(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+			value, ok := vars[*appEnvGetKey]
+			if !ok {
+				log.Fatalf("%s is not set.", *appEnvGetKey)
+			}
+			fmt.Println(value)
+		case *appEnvGetJSON:
+			vars, err := env.GetContext(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(vars); err != nil {
+				log.Fatal(err)
+			}
+		default:
+			content, err := env.ContentContext(ctx)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Print(content)
+		}
+	case appEnvSet.FullCommand():
+		server, site, err := george.SearchSite(ctx, *appEnvSetSite)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = george.SetEnv(ctx, server, site, *appEnvSetVars)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case appEnvUnset.FullCommand():
+		server, site, err := george.SearchSite(ctx, *appEnvUnsetSite)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = george.UnsetEnv(ctx, server, site, *appEnvUnsetKeys)
 		if err != nil {
 			log.Fatal(err)
 		}
-		session.Stderr = os.Stderr
-		pr, err := session.StdoutPipe()
+	case appEnvEdit.FullCommand():
+		server, site, err := george.SearchSite(ctx, *appEnvEditSite)
 		if err != nil {
 			log.Fatal(err)
 		}
-		cmd := fmt.Sprintf("mysqldump --host=%q --port=%q --user=%q --password=%q %q | gzip",
-			dbHost, dbPort, dbUser, dbPwd, dbName)
-		if err := session.Start(cmd); err != nil {
-			log.Fatalf("mysqldump: %v", err)
+		err = george.EditEnv(ctx, server, site)
+		if err != nil {
+			log.Fatal(err)
 		}
-		gzr, err := gzip.NewReader(pr)
+	case appEnvPull.FullCommand():
+		server, site, err := george.SearchSite(ctx, *appEnvPullSite)
 		if err != nil {
 			log.Fatal(err)
 		}
-		if _, err := io.Copy(os.Stdout, gzr); err != nil {
+		content, err := client.Env(server.Id, site.Id).ContentContext(ctx)
+		if err != nil {
 			log.Fatal(err)
 		}
-		if err := session.Wait(); err != nil {
-			log.Fatalf("mysqldump: %v", err)
+		if *appEnvPullFile == "-" {
+			fmt.Print(content)
+			break
+		}
+		// The .env file is full of secrets, so keep it private.
+		err = ioutil.WriteFile(*appEnvPullFile, []byte(content), 0600)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case appEnvPush.FullCommand():
+		content, err := readFile(*appEnvPushFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *appEnvPushFile == "-" && !*appEnvPushYes {
+			log.Fatal("Pushing from stdin requires --yes, since there's no way to confirm.")
+		}
+		server, site, err := george.SearchSite(ctx, *appEnvPushSite)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = george.PushEnv(ctx, server, site, string(content), *appEnvPushYes)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case appEnvDiff.FullCommand():
+		if (*appEnvDiffSiteB == "") == (*appEnvDiffFile == "") {
+			app.Errorf("Specify either another site or --file to compare with.")
+			os.Exit(errorExitCode)
+		}
+		server, site, err := george.SearchSite(ctx, *appEnvDiffSiteA)
+		if err != nil {
+			fatal(err)
+		}
+		a, err := client.Env(server.Id, site.Id).GetContext(ctx)
+		if err != nil {
+			fatal(err)
+		}
+		var b forge.DotEnv
+		var bName string
+		if *appEnvDiffFile != "" {
+			content, err := readFile(*appEnvDiffFile)
+			if err != nil {
+				fatal(err)
+			}
+			b, err = godotenv.Unmarshal(string(content))
+			if err != nil {
+				fatal(err)
+			}
+			bName = *appEnvDiffFile
+		} else {
+			server, site, err := george.SearchSite(ctx, *appEnvDiffSiteB)
+			if err != nil {
+				fatal(err)
+			}
+			b, err = client.Env(server.Id, site.Id).GetContext(ctx)
+			if err != nil {
+				fatal(err)
+			}
+			bName = site.Name
+		}
+		// Exit like diff(1), so drift can fail a CI job.
+		if diffEnv(os.Stdout, site.Name, bName, a, b, *appEnvDiffReveal) {
+			os.Exit(1)
+		}
+	case appAliasAdd.FullCommand():
+		err = george.AddAlias(*appAliasAddName, *appAliasAddPattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case appAliasRm.FullCommand():
+		err = george.RemoveAlias(*appAliasRmName)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case appAliasLs.FullCommand():
+		err = george.PrintAliases(os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case appHostKeysReset.FullCommand():
+		server, _, err := george.Search(ctx, *appHostKeysResetServer)
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := george.ResetHostKeys(server)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Removed %d host keys of %s (%s) from %s.\n",
+			n, server.Name, server.IPAddress, george.KnownHostsPath())
+	case appKeysList.FullCommand():
+		err = george.PrintKeys(ctx, os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+	case appKeysRotate.FullCommand():
+		err = george.RotateKey(ctx, george.expandHome(*appKeysRotateNew))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Rotated. From now on, george uses %s.\n", george.config.Identity)
+	case appKeysPrune.FullCommand():
+		var except [][]byte
+		for _, path := range *appKeysPruneExcept {
+			publicKey, err := readPublicKey(path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			except = append(except, publicKey)
+		}
+		err = george.PruneKeys(ctx, except, *appKeysPruneYes)
+		if err != nil {
+			log.Fatal(err)
 		}
 	case appSequelPro.FullCommand():
-		server, site, err := george.SearchSite(*appSequelProSite)
+		server, site, err := george.SearchSite(ctx, *appSequelProSite)
 		if err != nil {
 			log.Fatal(err)
 		}
 
 		// Parse .env file and extract MySQL connection settings.
-		env, err := client.Env(server.Id, site.Id).Get()
+		env, err := client.Env(server.Id, site.Id).GetContext(ctx)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -291,12 +936,6 @@ func main() {
 		dbUser := env.Get("DB_USERNAME")
 		dbPwd := env.Get("DB_PASSWORD")
 
-		// Open an SSH session and execute mysqldump.
-		err = george.SSHInstallKey(server.Id)
-		if err != nil {
-			log.Fatal(err)
-		}
-
 		localPort, err := freeport.GetFreePort()
 		if err != nil {
 			log.Fatal(err)
@@ -304,25 +943,16 @@ func main() {
 
 		fmt.Printf("tunneling for database %s:%s to 127.0.0.1:%d\n",
 			server.IPAddress, dbPort, localPort)
-		cmd := exec.Command("ssh",
-			"-L",
-			fmt.Sprintf("%d:%s:%s", localPort, server.IPAddress, dbPort),
-			"-N",
-			fmt.Sprintf("forge@%s", server.IPAddress))
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		c := make(chan os.Signal, 2)
-		signal.Notify(c, os.Interrupt, os.Kill)
-		go func() {
-			<-c
-			cmd.Process.Kill()
-			os.Exit(1)
-		}()
+		t := newTunnel(george, server.Id)
+		err = t.Listen([]forward{{
+			local:  fmt.Sprintf("127.0.0.1:%d", localPort),
+			remote: fmt.Sprintf("%s:%s", server.IPAddress, dbPort),
+		}})
+		if err != nil {
+			log.Fatal(err)
+		}
 
 		go func() {
-			time.Sleep(1 * time.Second)
-
 			fmt.Printf("Opening database in Sequel Pro...")
 
 			const fileTemplate = `
@@ -415,7 +1045,7 @@ func main() {
 			open.Run(file.Name())
 		}()
 
-		err = cmd.Run()
+		err = t.Serve(ctx)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -434,12 +1064,12 @@ func main() {
 			log.Fatal("WinSCP.exe does not exist.")
 		}
 
-		server, site, err := george.Search(*appWinSCPTarget)
+		server, site, err := george.Search(ctx, *appWinSCPTarget)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		err = george.SSHInstallKey(server.Id)
+		err = george.SSHInstallKey(ctx, server.Id)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -490,6 +1120,61 @@ func main() {
 	return
 }
 
+// readFile reads the named file, or stdin if name is "-".
+func readFile(name string) ([]byte, error) {
+	if name == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(name)
+}
+
+// newContext returns a context that's cancelled on the first interrupt,
+// or after timeout if it's positive. A second interrupt exits immediately.
+func newContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		<-c
+		cancel()
+		<-c
+		os.Exit(errorExitCode)
+	}()
+	return ctx, cancel
+}
+
+// splitList splits comma-separated values given to a repeatable flag.
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+	}
+	return list
+}
+
+// newClient returns a Forge client authenticated with the given API key.
+// Setting GEORGE_FORGE_URL points the client at a different Forge API,
+// such as a local mock.
+func newClient(key string) *forge.Client {
+	opts := []forge.Option{
+		forge.WithUserAgent("george"),
+	}
+	if url := os.Getenv("GEORGE_FORGE_URL"); url != "" {
+		opts = append(opts, forge.WithBaseURL(url))
+	}
+	return forge.New(key, opts...)
+}
+
 func saveAPIKey(key string) error {
 	ciphertext, err := Encrypt([]byte(key), encryptionKey)
 	if err != nil {
@@ -540,14 +1225,18 @@ func hintTargets(hintType hintType) func() []string {
 		if err != nil {
 			return nil
 		}
-		g, err := New(forge.New(key), cacheForever)
+		g, err := New(newClient(key), cacheForever)
 		if err != nil {
 			return nil
 		}
+		ctx := context.Background()
 
 		var list []string
+		for name := range g.config.Aliases {
+			list = append(list, name)
+		}
 		if hintType == hintAll || hintType == hintServers {
-			servers, err := g.cache.Servers()
+			servers, err := g.cache.Servers(ctx)
 			if err != nil {
 				return nil
 			}
@@ -557,7 +1246,7 @@ func hintTargets(hintType hintType) func() []string {
 			}
 		}
 		if hintType == hintAll || hintType == hintSites {
-			sites, err := g.cache.ServerSites(nil)
+			sites, err := g.cache.ServerSites(ctx, nil)
 			if err != nil {
 				return nil
 			}
@@ -570,3 +1259,36 @@ func hintTargets(hintType hintType) func() []string {
 		return list
 	}
 }
+
+// hintAliases completes alias names.
+func hintAliases() []string {
+	config, err := loadConfig()
+	if err != nil {
+		return nil
+	}
+	var list []string
+	for name := range config.Aliases {
+		list = append(list, name)
+	}
+	return list
+}
+
+// errorExitCode is the exit code of failures. It's 1 unless the command's
+// exit code 1 means something else.
+var errorExitCode = 1
+
+// fatal is like log.Fatal, but exits with errorExitCode.
+func fatal(v ...interface{}) {
+	log.Output(2, fmt.Sprint(v...))
+	os.Exit(errorExitCode)
+}
+
+// parsedCommand returns the command args select, even if they fail to
+// parse, or an empty string if they select none.
+func parsedCommand(args []string) string {
+	context, _ := app.ParseContext(args)
+	if context == nil || context.SelectedCommand == nil {
+		return ""
+	}
+	return context.SelectedCommand.FullCommand()
+}
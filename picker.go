@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// errPickCancelled is returned by pick when the user cancels.
+var errPickCancelled = errors.New("Cancelled.")
+
+// pickerRows is the number of items the picker shows at once.
+const pickerRows = 10
+
+// canPick reports whether pick can be used, which requires both stdin
+// and stderr to be terminals.
+func canPick() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd())) &&
+		terminal.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// pick lets the user choose one of items with the arrow keys, and returns
+// the index of the chosen item. The picker is rendered on stderr and
+// cleared once the user chooses.
+func pick(title string, items []string) (int, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := terminal.MakeRaw(fd)
+	if err != nil {
+		return 0, err
+	}
+	defer terminal.Restore(fd, state)
+	defer enableVirtualTerminal(fd, int(os.Stderr.Fd()))()
+
+	rows := len(items)
+	if rows > pickerRows {
+		rows = pickerRows
+	}
+	selected, offset := 0, 0
+	drawn := 0
+	draw := func() {
+		var b strings.Builder
+		if drawn > 0 {
+			fmt.Fprintf(&b, "\x1b[%dA", drawn)
+		}
+		b.WriteString("\r\x1b[J")
+		fmt.Fprintf(&b, "%s\r\n", title)
+		for i := offset; i < offset+rows; i++ {
+			if i == selected {
+				fmt.Fprintf(&b, "\x1b[7m> %s\x1b[0m\r\n", items[i])
+			} else {
+				fmt.Fprintf(&b, "  %s\r\n", items[i])
+			}
+		}
+		drawn = rows + 1
+		os.Stderr.WriteString(b.String())
+	}
+	clear := func() {
+		fmt.Fprintf(os.Stderr, "\x1b[%dA\r\x1b[J", drawn)
+	}
+	move := func(delta int) {
+		selected += delta
+		if selected < 0 {
+			selected = 0
+		}
+		if selected >= len(items) {
+			selected = len(items) - 1
+		}
+		if selected < offset {
+			offset = selected
+		}
+		if selected >= offset+rows {
+			offset = selected - rows + 1
+		}
+	}
+
+	buf := make([]byte, 16)
+	for {
+		draw()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			clear()
+			return 0, err
+		}
+		switch key := string(buf[:n]); key {
+		case "\x1b[A", "\x1bOA", "\x10", "k":
+			move(-1)
+		case "\x1b[B", "\x1bOB", "\x0e", "j":
+			move(1)
+		case "\x1b[5~":
+			move(-rows)
+		case "\x1b[6~":
+			move(rows)
+		case "\r", "\n":
+			clear()
+			return selected, nil
+		case "\x03", "\x1b", "q":
+			clear()
+			return 0, errPickCancelled
+		}
+	}
+}
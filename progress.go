@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// progressBarWidth is the number of characters in a progress bar.
+const progressBarWidth = 30
+
+// progressReader counts the bytes read through it, and draws a progress
+// bar of them on stderr while started, if stderr is a terminal.
+type progressReader struct {
+	n     int64 // Accessed atomically, so it comes first for alignment.
+	r     io.Reader
+	total int64
+	start time.Time
+}
+
+// newProgressReader returns a progressReader reading from r, which has
+// total bytes, or an unknown number if total isn't positive.
+func newProgressReader(r io.Reader, total int64) *progressReader {
+	return &progressReader{r: r, total: total}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	atomic.AddInt64(&p.n, int64(n))
+	return n, err
+}
+
+// Start starts drawing the progress bar until stop is called.
+func (p *progressReader) Start() (stop func()) {
+	if !terminal.IsTerminal(int(os.Stderr.Fd())) {
+		return func() {}
+	}
+	p.start = time.Now()
+	ticker := time.NewTicker(200 * time.Millisecond)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				p.draw()
+			case <-done:
+				p.draw()
+				fmt.Fprintln(os.Stderr)
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
+
+func (p *progressReader) draw() {
+	n := atomic.LoadInt64(&p.n)
+	var rate string
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		rate = formatBytes(int64(float64(n)/elapsed)) + "/s"
+	}
+	if p.total <= 0 {
+		fmt.Fprintf(os.Stderr, "\r\x1b[K%s  %s", formatBytes(n), rate)
+		return
+	}
+	if n > p.total {
+		n = p.total
+	}
+	filled := int(n * progressBarWidth / p.total)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	fmt.Fprintf(os.Stderr, "\r\x1b[K[%s] %3d%%  %s / %s  %s",
+		bar, n*100/p.total, formatBytes(n), formatBytes(p.total), rate)
+}
+
+// formatBytes formats a number of bytes for humans, such as 1.5 MB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
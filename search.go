@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gobwas/glob"
+
+	"github.com/zippoxer/george/forge"
+)
+
+// Match scores, from the loosest to the tightest match.
+const (
+	scoreSubsequence = iota + 1
+	scoreSubstring
+	scorePrefix
+	scoreExact
+)
+
+// globChars are the characters making a pattern a glob.
+const globChars = `*?[]{}\`
+
+// namePattern matches server names, IPs and site domains. Patterns with
+// glob metacharacters are matched as globs, and others fuzzily.
+type namePattern struct {
+	text string
+	glob glob.Glob
+}
+
+func compileNamePattern(pattern string) (*namePattern, error) {
+	p := &namePattern{text: strings.ToLower(pattern)}
+	if strings.ContainsAny(p.text, globChars) {
+		g, err := glob.Compile(p.text)
+		if err != nil {
+			return nil, err
+		}
+		p.glob = g
+	}
+	return p, nil
+}
+
+// Score returns how well name matches the pattern, or 0 if it doesn't.
+// An empty pattern matches everything.
+func (p *namePattern) Score(name string) int {
+	name = strings.ToLower(name)
+	switch {
+	case p.glob != nil:
+		if p.glob.Match(name) {
+			return scoreExact
+		}
+		return 0
+	case p.text == "" || name == p.text:
+		return scoreExact
+	case strings.HasPrefix(name, p.text):
+		return scorePrefix
+	case strings.Contains(name, p.text):
+		return scoreSubstring
+	case isSubsequence(p.text, name):
+		return scoreSubsequence
+	}
+	return 0
+}
+
+// Match reports whether name matches the pattern.
+func (p *namePattern) Match(name string) bool {
+	return p.Score(name) > 0
+}
+
+// isSubsequence reports whether the characters of sub appear in s in the
+// same order, though not necessarily next to each other.
+func isSubsequence(sub, s string) bool {
+	for _, c := range s {
+		if len(sub) == 0 {
+			break
+		}
+		if strings.HasPrefix(sub, string(c)) {
+			sub = sub[len(string(c)):]
+		}
+	}
+	return len(sub) == 0
+}
+
+// compileSearchPattern splits a pattern such as "server:site" into its
+// server and site patterns. The site pattern is nil if there's no colon.
+func compileSearchPattern(pattern string) (server, site *namePattern, err error) {
+	patterns := strings.SplitN(pattern, ":", 2)
+	server, err = compileNamePattern(patterns[0])
+	if err != nil {
+		return
+	}
+	if len(patterns) == 2 {
+		site, err = compileNamePattern(patterns[1])
+	}
+	return
+}
+
+// searchResult is a server, or a site on a server, matching a search.
+type searchResult struct {
+	Server *forge.Server
+	Site   *forge.Site
+	score  int
+}
+
+func (r searchResult) name() string {
+	if r.Site != nil {
+		return r.Site.Name
+	}
+	return r.Server.Name
+}
+
+func (r searchResult) String() string {
+	if r.Site != nil {
+		return fmt.Sprintf("%s (on %s)", r.Site.Name, r.Server.Name)
+	}
+	return fmt.Sprintf("%s (%s)", r.Server.Name, r.Server.IPAddress)
+}
+
+// serverScore returns how well the server's name or IP matches p.
+func serverScore(p *namePattern, server *forge.Server) int {
+	score := p.Score(server.Name)
+	if s := p.Score(server.IPAddress); s > score {
+		score = s
+	}
+	return score
+}
+
+// sortSearchResults sorts results from the best match to the worst, and
+// shorter names first among equally good matches.
+func sortSearchResults(results []searchResult) {
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if len(a.name()) != len(b.name()) {
+			return len(a.name()) < len(b.name())
+		}
+		return a.name() < b.name()
+	})
+}
+
+// bestSearchResults returns the results sharing the best score, assuming
+// results are sorted.
+func bestSearchResults(results []searchResult) []searchResult {
+	n := 0
+	for n < len(results) && results[n].score == results[0].score {
+		n++
+	}
+	return results[:n]
+}
@@ -1,11 +1,374 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+
 	"github.com/zippoxer/george/forge"
 )
 
-type SSH struct {
-	Client         *forge.Client
-	Cache          *cache
-	PrivateKeyPath string
+// SSHClient connects to the given server over SSH, registering the SSH key
+// with it first if needed.
+func (g *George) SSHClient(ctx context.Context, serverId int) (*ssh.Client, error) {
+	err := g.SSHInstallKey(ctx, serverId)
+	if err != nil {
+		return nil, err
+	}
+	signers, err := g.sshSigners()
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User: "forge",
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signers...),
+		},
+	}
+	server, err := g.cache.Server(ctx, serverId)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.hostKeyConfig(config, server); err != nil {
+		return nil, err
+	}
+	addr := fmt.Sprintf("%s:22", server.IPAddress)
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	// Abort the handshake if ctx is done before it completes.
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	close(done)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// maxPooledSessions is how many sessions are opened at once over a pooled
+// connection. It's the default MaxSessions of sshd, which rejects sessions
+// beyond it.
+const maxPooledSessions = 10
+
+// sshPoolEntry is a pooled connection, established by the first caller
+// asking for it while the others wait until ready is closed.
+type sshPoolEntry struct {
+	ready  chan struct{}
+	client *ssh.Client
+	err    error
+
+	// sessions is the number of callers using the connection, guarded by
+	// sshPoolMu.
+	sessions int
+}
+
+// pooledSSHClient returns a connection to the given server, shared with
+// other callers until CloseSSHClients is called. Each caller may open one
+// session over it, and must call release once the session is closed. Once
+// every connection to the server has maxPooledSessions callers, another
+// connection is opened.
+func (g *George) pooledSSHClient(ctx context.Context, serverId int) (client *ssh.Client, release func(), err error) {
+	g.sshPoolMu.Lock()
+	if g.sshPool == nil {
+		g.sshPool = make(map[int][]*sshPoolEntry)
+	}
+	var e *sshPoolEntry
+	for _, pooled := range g.sshPool[serverId] {
+		if pooled.sessions < maxPooledSessions {
+			e = pooled
+			break
+		}
+	}
+	dial := e == nil
+	if dial {
+		e = &sshPoolEntry{ready: make(chan struct{})}
+		g.sshPool[serverId] = append(g.sshPool[serverId], e)
+	}
+	e.sessions++
+	g.sshPoolMu.Unlock()
+	release = func() {
+		g.sshPoolMu.Lock()
+		e.sessions--
+		g.sshPoolMu.Unlock()
+	}
+
+	if dial {
+		e.client, e.err = g.SSHClient(ctx, serverId)
+		if e.err != nil {
+			// Let later callers try again.
+			g.sshPoolMu.Lock()
+			g.sshPool[serverId] = removePoolEntry(g.sshPool[serverId], e)
+			g.sshPoolMu.Unlock()
+		}
+		close(e.ready)
+	}
+	select {
+	case <-e.ready:
+		if e.err != nil {
+			release()
+			return nil, nil, e.err
+		}
+		return e.client, release, nil
+	case <-ctx.Done():
+		release()
+		return nil, nil, ctx.Err()
+	}
+}
+
+func removePoolEntry(entries []*sshPoolEntry, e *sshPoolEntry) []*sshPoolEntry {
+	for i := range entries {
+		if entries[i] == e {
+			return append(entries[:i:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
+
+// CloseSSHClients closes the connections opened by pooledSSHClient.
+func (g *George) CloseSSHClients() {
+	g.sshPoolMu.Lock()
+	defer g.sshPoolMu.Unlock()
+	for id, entries := range g.sshPool {
+		for _, e := range entries {
+			select {
+			case <-e.ready:
+				if e.client != nil {
+					e.client.Close()
+				}
+				entries = removePoolEntry(entries, e)
+			default:
+			}
+		}
+		if len(entries) == 0 {
+			delete(g.sshPool, id)
+		} else {
+			g.sshPool[id] = entries
+		}
+	}
+}
+
+// SSH opens a session with the given server.
+func (g *George) SSH(ctx context.Context, serverId int) (*ssh.Session, error) {
+	client, err := g.SSHClient(ctx, serverId)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewSession()
+}
+
+// SSHInstallKey registers the public SSH key with the given forge server,
+// returning an error if installation failed.
+func (g *George) SSHInstallKey(ctx context.Context, serverId int) error {
+	publicKey, err := g.sshPublicKey()
+	if err != nil {
+		return err
+	}
+	return g.installKey(ctx, serverId, publicKey)
+}
+
+// installKey registers publicKey with the given forge server unless it's
+// already registered, and waits until it's installed.
+func (g *George) installKey(ctx context.Context, serverId int, publicKey []byte) error {
+	keyNames := g.sshKeyNames(publicKey)
+
+	keys, err := g.client.Keys(serverId).ListContext(ctx)
+	if err != nil {
+		return err
+	}
+	var key *forge.Key
+	for i := range keys {
+		if hasName(keyNames, keys[i].Name) {
+			key = &keys[i]
+			break
+		}
+	}
+	if key == nil {
+		key, err := g.client.Keys(serverId).CreateContext(ctx, keyNames[0], string(publicKey))
+		if err != nil {
+			return err
+		}
+		for key.Status == "installing" {
+			if err := sleep(ctx, time.Millisecond*500); err != nil {
+				return err
+			}
+			key, err = g.client.Keys(serverId).GetContext(ctx, key.Id)
+			if err != nil {
+				return err
+			}
+		}
+		if key.Status != "installed" {
+			return fmt.Errorf("failed installing SSH key: status is %v", key.Status)
+		}
+	}
+	return nil
+}
+
+// SSHShell runs command on the given server, or a login shell if command is
+// empty, connecting it to the local terminal. It returns the exit code of
+// the remote command.
+func (g *George) SSHShell(ctx context.Context, serverId int, command string) (int, error) {
+	session, err := g.SSH(ctx, serverId)
+	if err != nil {
+		return 0, err
+	}
+	defer session.Close()
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	// The size is read from stdout, since Windows only reports it for the
+	// console's output.
+	fd, outFd := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if terminal.IsTerminal(fd) {
+		width, height, err := terminal.GetSize(outFd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		term := os.Getenv("TERM")
+		if term == "" {
+			term = "xterm-256color"
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty(term, height, width, modes); err != nil {
+			return 0, err
+		}
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return 0, err
+		}
+		defer terminal.Restore(fd, state)
+		defer enableVirtualTerminal(fd, outFd)()
+		stop := watchResize(outFd, func(width, height int) {
+			session.WindowChange(height, width)
+		})
+		defer stop()
+	}
+
+	if command == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(command)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer closeOnDone(ctx, session)()
+	code, err := exitCode(session.Wait())
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	return code, err
+}
+
+// closeOnDone closes session once ctx is done, until stop is called.
+func closeOnDone(ctx context.Context, session *ssh.Session) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// exitCode extracts the exit code of a remote command from the error
+// returned by ssh.Session.Wait.
+func exitCode(err error) (int, error) {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// shellQuote quotes s for use as a single word in a POSIX shell command.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// splitShellWords splits s into words like a POSIX shell would, minus
+// expansions: words are separated by unquoted whitespace, single quotes
+// keep everything literally, and backslashes escape the next character,
+// or inside double quotes, one of $`"\ or a newline.
+func splitShellWords(s string) ([]string, error) {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+		quote  rune
+	)
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			i++
+			if i == len(runes) {
+				return nil, fmt.Errorf("Trailing backslash in %q.", s)
+			}
+			if quote == '"' && !strings.ContainsRune("$`\"\\\n", runes[i]) {
+				word.WriteRune(r)
+			}
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Unterminated %c quote in %q.", quote, s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
 }
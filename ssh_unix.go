@@ -0,0 +1,42 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// watchResize calls resize with the new size of the terminal fd whenever
+// it's resized, until stop is called.
+func watchResize(fd int, resize func(width, height int)) (stop func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGWINCH)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-c:
+				if width, height, err := terminal.GetSize(fd); err == nil {
+					resize(width, height)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
+
+// enableVirtualTerminal is a no-op, since Unix terminals always pass
+// escape sequences through.
+func enableVirtualTerminal(inFd, outFd int) (restore func()) {
+	return func() {}
+}
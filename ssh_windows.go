@@ -0,0 +1,65 @@
+package main
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/sys/windows"
+)
+
+// watchResize calls resize with the new size of the terminal fd whenever
+// it's resized, until stop is called. Windows has no SIGWINCH, so the size
+// is polled instead.
+func watchResize(fd int, resize func(width, height int)) (stop func()) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		width, height, _ := terminal.GetSize(fd)
+		for {
+			select {
+			case <-ticker.C:
+				w, h, err := terminal.GetSize(fd)
+				if err == nil && (w != width || h != height) {
+					width, height = w, h
+					resize(width, height)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// enableVirtualTerminal makes the console send special keys such as arrows
+// as escape sequences on inFd, and interpret the escape sequences written to
+// outFd, which remote shells rely on. It's best effort, since consoles older
+// than Windows 10 support neither.
+func enableVirtualTerminal(inFd, outFd int) (restore func()) {
+	var restores []func()
+	for _, c := range []struct {
+		fd   int
+		mode uint32
+	}{
+		{inFd, windows.ENABLE_VIRTUAL_TERMINAL_INPUT},
+		{outFd, windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING | windows.ENABLE_PROCESSED_OUTPUT},
+	} {
+		h := windows.Handle(c.fd)
+		var mode uint32
+		if err := windows.GetConsoleMode(h, &mode); err != nil {
+			continue
+		}
+		if err := windows.SetConsoleMode(h, mode|c.mode); err != nil {
+			continue
+		}
+		restores = append(restores, func() { windows.SetConsoleMode(h, mode) })
+	}
+	return func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+}
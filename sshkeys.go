@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// defaultIdentities are the private keys looked for in ~/.ssh, in order,
+// when no identity is given. id_rsa comes first since it's the key george
+// always used, and so the one already registered with servers.
+var defaultIdentities = []string{"id_rsa", "id_ed25519", "id_ecdsa"}
+
+// SSHPrivateKeyPath returns the path of the private key george uses,
+// which is either the one given with --identity or the first of the
+// default identities that exists. If none exists, it's where a new
+// ed25519 key is generated.
+func (g *George) SSHPrivateKeyPath() string {
+	if g.identity != "" {
+		return g.identity
+	}
+	for _, name := range defaultIdentities {
+		path := filepath.Join(g.homeDir, ".ssh", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(g.homeDir, ".ssh", "id_ed25519")
+}
+
+// expandHome replaces a leading ~ in path with the home directory.
+func (g *George) expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") || strings.HasPrefix(path, `~\`) {
+		return filepath.Join(g.homeDir, path[1:])
+	}
+	return path
+}
+
+func (g *George) SSHPublicKeyPath() string {
+	return g.SSHPrivateKeyPath() + ".pub"
+}
+
+// sshPublicKey returns the public key george registers with servers, in
+// authorized_keys format.
+//
+// It's the public key of the identity file if there's one, or else the
+// first key in ssh-agent. If there's neither, a new key is generated.
+func (g *George) sshPublicKey() ([]byte, error) {
+	g.publicKeyMu.Lock()
+	defer g.publicKeyMu.Unlock()
+	if g.publicKey == nil {
+		key, err := g.findPublicKey()
+		if err != nil {
+			return nil, err
+		}
+		g.publicKey = key
+	}
+	return g.publicKey, nil
+}
+
+func (g *George) findPublicKey() ([]byte, error) {
+	privateKeyPath := g.SSHPrivateKeyPath()
+	data, err := ioutil.ReadFile(g.SSHPublicKeyPath())
+	if err == nil && len(data) > 0 {
+		return data, nil
+	}
+	if _, err := os.Stat(privateKeyPath); err == nil {
+		// There's no .pub file, so derive the public key.
+		signer, err := g.loadPrivateKey(privateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		return ssh.MarshalAuthorizedKey(signer.PublicKey()), nil
+	}
+	if g.identity == "" {
+		if signers := g.sshAgentSigners(); len(signers) > 0 {
+			return ssh.MarshalAuthorizedKey(signers[0].PublicKey()), nil
+		}
+		if err := g.sshKeygen(privateKeyPath); err != nil {
+			return nil, err
+		}
+		return g.findPublicKey()
+	}
+	return nil, fmt.Errorf("SSH key %s does not exist.", privateKeyPath)
+}
+
+// readPublicKey reads a public key file in authorized_keys format.
+func readPublicKey(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, _, _, err := ssh.ParseAuthorizedKey(data); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return data, nil
+}
+
+// sshSigners returns the keys to authenticate with, starting with the key
+// george registers with servers. The agent's copy of the key is preferred,
+// so that passphrase-protected keys loaded into the agent don't prompt.
+func (g *George) sshSigners() ([]ssh.Signer, error) {
+	g.signersMu.Lock()
+	defer g.signersMu.Unlock()
+	if g.signers != nil {
+		return g.signers, nil
+	}
+
+	publicKeyBytes, err := g.sshPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(publicKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	var signer ssh.Signer
+	var others []ssh.Signer
+	for _, s := range g.sshAgentSigners() {
+		if signer == nil && bytes.Equal(s.PublicKey().Marshal(), publicKey.Marshal()) {
+			signer = s
+		} else {
+			others = append(others, s)
+		}
+	}
+	if signer == nil {
+		signer, err = g.loadPrivateKey(g.SSHPrivateKeyPath())
+		if err != nil {
+			return nil, err
+		}
+	}
+	g.signers = append([]ssh.Signer{signer}, others...)
+	return g.signers, nil
+}
+
+// sshAgentSigners returns the keys held by the ssh-agent listening on
+// SSH_AUTH_SOCK, if any.
+func (g *George) sshAgentSigners() []ssh.Signer {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return nil
+	}
+	conn, err := net.Dial("unix", sock)
+	if err != nil {
+		return nil
+	}
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		return nil
+	}
+	return signers
+}
+
+// loadPrivateKey parses the private key in the given file, prompting for
+// its passphrase if it's encrypted.
+func (g *George) loadPrivateKey(path string) (ssh.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return signer, err
+	}
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, fmt.Errorf("SSH key %s is protected by a passphrase. Add it to ssh-agent with: ssh-add %s", path, path)
+	}
+	fmt.Fprintf(os.Stderr, "Enter passphrase for %s: ", path)
+	passphrase, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(data, passphrase)
+}
+
+func (g *George) sshKeygen(privateKeyPath string) error {
+	fmt.Fprintf(os.Stderr, "Generating an SSH key at %s...\n", privateKeyPath)
+	// -N="" means empty password.
+	_, err := exec.Command("ssh-keygen", "-t", "ed25519", "-N", "", "-f", privateKeyPath).CombinedOutput()
+	return err
+}
+
+// sshKeyName returns a unique, irreversible and reproducible name for the given SSH key.
+func (s *George) sshKeyName(key []byte) string {
+	sum := sha512.Sum512_224(key)
+	sumStr := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(sum[:])
+	return "george-" + sumStr
+}
+
+// sshKeyNames returns the names key may be registered under. The first is
+// the name of the key without its comment, which george registers keys as,
+// so that a key is named the same whatever its comment. The second, if
+// different, is the name of key as is, which older versions of george
+// registered keys as.
+func (g *George) sshKeyNames(key []byte) []string {
+	names := []string{g.sshKeyName(key)}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(key)
+	if err != nil {
+		return names
+	}
+	normalized := g.sshKeyName(ssh.MarshalAuthorizedKey(publicKey))
+	if normalized == names[0] {
+		return names
+	}
+	return []string{normalized, names[0]}
+}
+
+// hasName reports whether name is one of names.
+func hasName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
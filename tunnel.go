@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// keepaliveInterval is how often a tunnel checks its SSH connection is
+// still alive.
+const keepaliveInterval = 15 * time.Second
+
+// forward is a local address forwarded to an address dialed from a server.
+type forward struct {
+	local  string
+	remote string
+}
+
+// parseForward parses a forward of the form local-port:remote-port or
+// local-port:remote-host:remote-port. Remote ports without a host are
+// dialed at defaultHost.
+func parseForward(spec, defaultHost string) (forward, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return forward{}, fmt.Errorf("Forward %q is not of the form local-port:[remote-host:]remote-port.", spec)
+	}
+	if _, err := strconv.ParseUint(parts[0], 10, 16); err != nil {
+		return forward{}, fmt.Errorf("Invalid local port in forward %q.", spec)
+	}
+	remote := parts[1]
+	if _, err := strconv.ParseUint(remote, 10, 16); err == nil {
+		remote = net.JoinHostPort(defaultHost, remote)
+	} else if _, _, err := net.SplitHostPort(remote); err != nil {
+		return forward{}, fmt.Errorf("Invalid remote address in forward %q.", spec)
+	}
+	return forward{
+		local:  net.JoinHostPort("127.0.0.1", parts[0]),
+		remote: remote,
+	}, nil
+}
+
+// tunnel forwards local ports through an SSH connection to a server,
+// reconnecting whenever the connection drops.
+type tunnel struct {
+	g         *George
+	serverId  int
+	listeners map[net.Listener]forward
+
+	mu        sync.Mutex
+	client    *ssh.Client
+	connected bool // Whether the first connection succeeded.
+
+	// fail stops Serve with the given error, which is kept in err.
+	fail func(err error)
+	err  error
+}
+
+func newTunnel(g *George, serverId int) *tunnel {
+	return &tunnel{
+		g:         g,
+		serverId:  serverId,
+		listeners: make(map[net.Listener]forward),
+	}
+}
+
+// Listen starts listening on the local address of each forward.
+func (t *tunnel) Listen(forwards []forward) error {
+	for _, f := range forwards {
+		l, err := net.Listen("tcp", f.local)
+		if err != nil {
+			t.closeListeners()
+			return err
+		}
+		t.listeners[l] = f
+	}
+	return nil
+}
+
+func (t *tunnel) closeListeners() {
+	for l := range t.listeners {
+		l.Close()
+	}
+}
+
+// Serve forwards connections until ctx is done, or until reconnecting
+// fails for a reason that retrying won't fix.
+func (t *tunnel) Serve(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var failOnce sync.Once
+	t.fail = func(err error) {
+		failOnce.Do(func() {
+			t.err = err
+			cancel()
+		})
+	}
+	if _, err := t.connect(ctx); err != nil {
+		t.closeListeners()
+		return err
+	}
+	var wg sync.WaitGroup
+	for l, f := range t.listeners {
+		wg.Add(1)
+		go func(l net.Listener, f forward) {
+			defer wg.Done()
+			t.accept(ctx, l, f)
+		}(l, f)
+	}
+	<-ctx.Done()
+	t.closeListeners()
+	wg.Wait()
+	t.mu.Lock()
+	if t.client != nil {
+		t.client.Close()
+	}
+	t.mu.Unlock()
+	return t.err
+}
+
+func (t *tunnel) accept(ctx context.Context, l net.Listener, f forward) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", f.local, err)
+			}
+			return
+		}
+		go func() {
+			defer conn.Close()
+			if err := t.forward(ctx, conn, f.remote); err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "%s -> %s: %v\n", f.local, f.remote, err)
+			}
+		}()
+	}
+}
+
+// forward pipes conn to the remote address until either side closes.
+func (t *tunnel) forward(ctx context.Context, conn net.Conn, remoteAddr string) error {
+	client, err := t.connect(ctx)
+	if err != nil {
+		return err
+	}
+	remote, err := client.Dial("tcp", remoteAddr)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, remote)
+		done <- struct{}{}
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// connect returns the current SSH connection. The first connection fails
+// right away, while reconnecting retries network errors with backoff until
+// it succeeds or ctx is done. Any other error, such as a changed host key
+// or a rejected key, stops the tunnel.
+func (t *tunnel) connect(ctx context.Context) (*ssh.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client != nil {
+		return t.client, nil
+	}
+	backoff := time.Second
+	for {
+		client, err := t.g.SSHClient(ctx, t.serverId)
+		if err == nil {
+			t.client = client
+			t.connected = true
+			go t.watch(ctx, client)
+			return client, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !t.connected {
+			return nil, err
+		}
+		if !isNetworkError(err) {
+			t.fail(err)
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "Connection failed, retrying in %v: %v\n", backoff, err)
+		if err := sleep(ctx, backoff); err != nil {
+			return nil, err
+		}
+		if backoff *= 2; backoff > 30*time.Second {
+			backoff = 30 * time.Second
+		}
+	}
+}
+
+// watch sends keepalives over client, and reconnects once it's dead.
+func (t *tunnel) watch(ctx context.Context, client *ssh.Client) {
+	closed := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(closed)
+	}()
+	ticker := time.NewTicker(keepaliveInterval)
+	defer ticker.Stop()
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				client.Close()
+			}
+		case <-closed:
+			break loop
+		case <-ctx.Done():
+			return
+		}
+	}
+	t.mu.Lock()
+	if t.client == client {
+		t.client = nil
+	}
+	t.mu.Unlock()
+	if ctx.Err() != nil {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Connection lost, reconnecting...")
+	if _, err := t.connect(ctx); err == nil {
+		fmt.Fprintln(os.Stderr, "Reconnected.")
+	}
+}
+
+// isNetworkError reports whether err is worth retrying because the server
+// couldn't be reached, rather than because it was rejected, or rejected us.
+// The ssh package flattens handshake errors into strings, so they're told
+// apart by their message.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "ssh: handshake failed: ") {
+		return false
+	}
+	return strings.HasSuffix(msg, "EOF") ||
+		strings.Contains(msg, "connection reset by peer") ||
+		strings.Contains(msg, "i/o timeout")
+}